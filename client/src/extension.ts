@@ -50,6 +50,9 @@ export async function activate(context: vscode.ExtensionContext) {
           language: "*",
         },
       ],
+      synchronize: {
+        configurationSection: "puter",
+      },
     };
   })();
 
@@ -74,6 +77,7 @@ export async function activate(context: vscode.ExtensionContext) {
     (
       ...payloads: Array<{
         uri: string;
+        version?: number;
         interpretations: Array<{
           LineIndex: number;
           EvalResult: string;
@@ -95,6 +99,13 @@ export async function activate(context: vscode.ExtensionContext) {
       }
 
       for (const payload of payloads) {
+        // Reports for an older version would put results on the wrong lines.
+        if (
+          payload.version !== undefined &&
+          payload.version !== editor.document.version
+        ) {
+          continue;
+        }
         const decorationOptions: vscode.DecorationOptions[] =
           payload.interpretations.map((evaluation) => {
             const line = editor.document.lineAt(evaluation.LineIndex);
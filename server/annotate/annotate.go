@@ -0,0 +1,80 @@
+// Package annotate lays out the results of the pipe lines of a file as plain text, next
+// to the lines or written into them, for places without an editor to decorate them.
+package annotate
+
+import (
+	"fmt"
+	"puter/interpreter"
+	"strings"
+	"unicode/utf8"
+)
+
+// Returns the pipe lines of text, prefixed with name and their line number, with their
+// results aligned in a column to the right of the longest line. A line that could not
+// be evaluated shows its first diagnostic instead.
+//
+//	budget.md:3  // | rent = 1200  => 1200
+//	budget.md:4  // | rent *       error: Unrecognized prefix token EOF
+func Columns(name string, text string, interpretations []*interpreter.Interpretation) string {
+	lines := strings.Split(text, "\n")
+	locations := make([]string, len(interpretations))
+	sources := make([]string, len(interpretations))
+	locationWidth, sourceWidth := 0, 0
+	for i, interpretation := range interpretations {
+		locations[i] = fmt.Sprintf("%s:%d", name, interpretation.LineIndex+1)
+		sources[i] = strings.TrimSpace(expression(lines[interpretation.LineIndex], interpretation) + " " + interpretation.Suffix)
+		locationWidth = max(locationWidth, utf8.RuneCountInString(locations[i]))
+		sourceWidth = max(sourceWidth, utf8.RuneCountInString(sources[i]))
+	}
+
+	builder := strings.Builder{}
+	for i, interpretation := range interpretations {
+		annotation := ""
+		switch {
+		case len(interpretation.Diagnostics) > 0:
+			annotation = "error: " + interpretation.Diagnostics[0].Message
+		case interpretation.EvalResult != "":
+			annotation = interpreter.ResultSeparator + " " + interpretation.EvalResult
+		}
+		line := pad(locations[i], locationWidth) + "  " + pad(sources[i], sourceWidth) + "  " + annotation
+		builder.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return builder.String()
+}
+
+// Returns text with the result of every pipe line written after it, `// | 1 + 2  => 3`
+// or `<!-- | 1 + 2  => 3 -->`, replacing the result written before. A line without a
+// result loses its written result, an outdated result would be worse than none.
+func Write(text string, interpretations []*interpreter.Interpretation) string {
+	lines := strings.Split(text, "\n")
+	for _, interpretation := range interpretations {
+		line := lines[interpretation.LineIndex]
+		hasResult := interpretation.EvalResult != "" && len(interpretation.Diagnostics) == 0
+		if !hasResult && !strings.Contains(line[interpretation.Column:], interpreter.ResultSeparator) {
+			continue
+		}
+
+		body, carriageReturn := strings.CutSuffix(line, "\r")
+		written := strings.TrimRight(expression(body, interpretation), " \t\r")
+		if hasResult {
+			written += "  " + interpreter.ResultSeparator + " " + interpretation.EvalResult
+		}
+		if interpretation.Suffix != "" {
+			written += " " + interpretation.Suffix
+		}
+		if carriageReturn {
+			written += "\r"
+		}
+		lines[interpretation.LineIndex] = written
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The line up to the end of its expression, without the result written after it.
+func expression(line string, interpretation *interpreter.Interpretation) string {
+	return line[:interpretation.Column] + interpretation.Text
+}
+
+func pad(text string, width int) string {
+	return text + strings.Repeat(" ", width-utf8.RuneCountInString(text))
+}
@@ -0,0 +1,69 @@
+package annotate
+
+import (
+	"puter/interpreter"
+	"puter/unit"
+	"testing"
+)
+
+func interpret(t *testing.T, text string) []*interpreter.Interpretation {
+	converters := &unit.Converters{
+		ConvertCurrency: func(fromValue float64, fromUnit string, toUnit string) (float64, error) {
+			return fromValue * 2, nil
+		},
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+	in := interpreter.NewInterpreter(t.Context(), converters)
+	in.SetOptions(interpreter.FileOptions())
+	return in.Interpret(text)
+}
+
+func TestColumns(t *testing.T) {
+	text := "# Notes\n// | x = 2 km  => 1 km\n  // | x in m\n// | x +\n"
+	expected := "" +
+		"notes.md:2  // | x = 2 km  => 2 kilometers\n" +
+		"notes.md:3  // | x in m    => 2000 meters\n" +
+		"notes.md:4  // | x +       error: Unrecognized prefix token EOF\n"
+	if columns := Columns("notes.md", text, interpret(t, text)); columns != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, columns)
+	}
+}
+
+func TestWriteBeforeClosingMarker(t *testing.T) {
+	converters := &unit.Converters{ConvertFixedUnit: unit.GetFixedUnitConverter()}
+	in := interpreter.NewInterpreter(t.Context(), converters)
+	in.SetOptions(interpreter.FileOptions())
+	text := "<!-- | 1 + 2 -->\n<!-- | 2 * 3  => 5 -->\n"
+	expected := "<!-- | 1 + 2  => 3 -->\n<!-- | 2 * 3  => 6 -->\n"
+	for range 2 {
+		interpretations, err := in.ReinterpretLanguage(t.Context(), "html", nil, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text = Write(text, interpretations); text != expected {
+			t.Fatalf("expected %q, got %q", expected, text)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{"// | 1 + 2\n", "// | 1 + 2  => 3\n"},
+		{"// | 1 + 2   => 4\n", "// | 1 + 2  => 3\n"},
+		{"# | 2 * 3\r\n# | 4\r\n", "# | 2 * 3  => 6\r\n# | 4  => 4\r\n"},
+		// Lines without a result lose the written one, other lines are left alone.
+		{"// | 1 +  => 3\n// | 1 +\nconst f = () => 1\n//|\n", "// | 1 +\n// | 1 +\nconst f = () => 1\n//|\n"},
+	}
+	for _, c := range cases {
+		written := Write(c.text, interpret(t, c.text))
+		if written != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, written)
+		}
+		if again := Write(written, interpret(t, written)); again != written {
+			t.Errorf("writing %q again changed it to %q", written, again)
+		}
+	}
+}
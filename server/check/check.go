@@ -0,0 +1,151 @@
+// Package check finds the pipe lines that can't be evaluated, and the assertions that fail,
+// in the files of a directory, so that calculations in docs that broke fail a build.
+package check
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"puter/interpreter"
+	"strings"
+	"unicode/utf8"
+)
+
+// Directories that never hold docs worth checking, ignored besides the globs given.
+var DefaultIgnore = []string{".git", "node_modules"}
+
+// A diagnostic of a pipe line. Lines and columns start at 1, columns count characters.
+type Problem struct {
+	Path      string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Message   string
+	// Whether the problem is an assertion that failed rather than a line that could not
+	// be evaluated.
+	Assertion bool
+}
+
+// Returns the files under roots whose path, relative to their root, matches one of
+// include, or every file when include is empty. Files and directories matching one of
+// ignore are skipped. A root that is a file is returned as it is.
+func Find(roots []string, include []string, ignore []string) ([]string, error) {
+	files := []string{}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name == root {
+				if !entry.IsDir() {
+					files = append(files, name)
+				}
+				return nil
+			}
+			relative, err := filepath.Rel(root, name)
+			if err != nil {
+				return err
+			}
+			relative = filepath.ToSlash(relative)
+			if matchAny(ignore, relative) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !entry.IsDir() && (len(include) == 0 || matchAny(include, relative)) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether a slash separated path matches pattern. Like in .gitignore, a pattern
+// without a slash matches the last element of the path, like *.md, and `**` matches
+// any number of directories, like docs/**/*.md.
+func Match(pattern string, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(name))
+		return matched
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(patterns []string, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		for skipped := 0; skipped <= len(names); skipped++ {
+			if matchSegments(patterns[1:], names[skipped:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	matched, _ := path.Match(patterns[0], names[0])
+	return matched && matchSegments(patterns[1:], names[1:])
+}
+
+// Interprets the file at name, with the comment markers of the language of its extension,
+// and returns the diagnostics of its pipe lines. Binary files have no pipe lines and are
+// skipped.
+func File(ctx context.Context, in *interpreter.Interpreter, name string) ([]*Problem, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	// Like git, a file with a zero byte near its start is taken for binary.
+	if bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return nil, nil
+	}
+
+	text := string(content)
+	interpretations, err := in.ReinterpretLanguage(ctx, interpreter.LanguageOfFile(name), nil, text)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(text, "\n")
+	problems := []*Problem{}
+	for _, interpretation := range interpretations {
+		for _, diagnostic := range interpretation.Diagnostics {
+			start, end := diagnostic.Range.Start, diagnostic.Range.End
+			problems = append(problems, &Problem{
+				Path:      name,
+				Line:      int(start.Line) + 1,
+				Column:    column(lines[start.Line], int(start.Character)),
+				EndLine:   int(end.Line) + 1,
+				EndColumn: column(lines[end.Line], int(end.Character)),
+				Message:   diagnostic.Message,
+				Assertion: diagnostic.Code != nil && diagnostic.Code.String != nil && *diagnostic.Code.String == interpreter.AssertionFailedCode,
+			})
+		}
+	}
+	return problems, nil
+}
+
+// Diagnostics count bytes, problems count characters from 1.
+func column(line string, offset int) int {
+	return utf8.RuneCountInString(line[:min(offset, len(line))]) + 1
+}
@@ -0,0 +1,135 @@
+package check
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"puter/interpreter"
+	"puter/unit"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-json-experiment/json"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"*.md", "docs/guide.txt", false},
+		{"node_modules", "client/node_modules", true},
+		{"docs/*.md", "docs/intro.md", true},
+		{"docs/*.md", "docs/guide/intro.md", false},
+		{"docs/**/*.md", "docs/intro.md", true},
+		{"docs/**/*.md", "docs/guide/deep/intro.md", true},
+		{"docs/**", "docs/guide", true},
+		{"/docs/old/", "docs/old", true},
+		{"docs/old", "other/docs/old", false},
+	}
+	for _, c := range cases {
+		if Match(c.pattern, c.name) != c.expected {
+			t.Errorf("expected %s matching %s to be %t", c.pattern, c.name, c.expected)
+		}
+	}
+}
+
+func TestColumnCountsCharacters(t *testing.T) {
+	// ä is two bytes but one character.
+	if column("// | ä + x", 10) != 10 {
+		t.Errorf("expected column 10, got %d", column("// | ä + x", 10))
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestFind(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"README.md":               "",
+		"docs/intro.md":           "",
+		"docs/notes.txt":          "",
+		"docs/old/outdated.md":    "",
+		"node_modules/x/lib.md":   "",
+		"client/src/extension.ts": "",
+	})
+	files, err := Find([]string{root}, []string{"*.md", "*.ts"}, append([]string{"docs/old"}, DefaultIgnore...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := []string{}
+	for _, file := range files {
+		relative, _ := filepath.Rel(root, file)
+		found = append(found, filepath.ToSlash(relative))
+	}
+	slices.Sort(found)
+	expected := []string{"README.md", "client/src/extension.ts", "docs/intro.md"}
+	if !slices.Equal(found, expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+}
+
+func TestFileAndFormats(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"budget.md":  "# Budget\n// | rent = 1200\n// | rent +\n  // | rent * missing\n",
+		"binary.dat": "\x00// | 1 +",
+	})
+	converters := &unit.Converters{
+		ConvertCurrency: func(fromValue float64, fromUnit string, toUnit string) (float64, error) {
+			return fromValue, nil
+		},
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+	in := interpreter.NewInterpreter(t.Context(), converters)
+
+	binary, err := File(t.Context(), in, filepath.Join(root, "binary.dat"))
+	if err != nil || len(binary) != 0 {
+		t.Fatalf("expected a binary file to be skipped, got %v, %v", binary, err)
+	}
+
+	name := filepath.Join(root, "budget.md")
+	problems, err := File(t.Context(), in, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := &bytes.Buffer{}
+	if err := WriteText(text, problems); err != nil {
+		t.Fatal(err)
+	}
+	expected := name + ":3:12: Unrecognized prefix token EOF\n" + name + ":4:15: Identifier missing not found\n"
+	if !strings.HasPrefix(text.String(), expected) {
+		t.Errorf("expected the text to start with\n%s\ngot\n%s", expected, text)
+	}
+
+	sarif := &bytes.Buffer{}
+	if err := WriteSARIF(sarif, problems); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(sarif.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	results := log.Runs[0].Results
+	if log.Version != "2.1.0" || len(results) != len(problems) {
+		t.Fatalf("expected a SARIF 2.1.0 log with %d results, got %s", len(problems), sarif)
+	}
+	region := results[1].Locations[0].PhysicalLocation.Region
+	if region.StartLine != 4 || region.StartColumn != 15 || region.EndColumn != 22 {
+		t.Errorf("unexpected region %+v", region)
+	}
+}
@@ -0,0 +1,58 @@
+// Package checktest runs the pipe lines of docs as part of go test, so that the assertions
+// of the docs guard the numbers they document.
+//
+//	func TestDocs(t *testing.T) {
+//		checktest.Run(t, "../docs", checktest.Options{Include: []string{"*.md"}})
+//	}
+package checktest
+
+import (
+	"puter/check"
+	"puter/interpreter"
+	"puter/unit"
+	"slices"
+	"testing"
+)
+
+type Options struct {
+	// Globs of the files to check, every file when empty, see check.Find.
+	Include []string
+	// Globs of the files and directories to skip besides check.DefaultIgnore.
+	Ignore []string
+	// Converters to evaluate with. Live exchange rates and the fixed units when nil, pass
+	// fixed rates for assertions on currencies that should not change with the market.
+	Converters *unit.Converters
+}
+
+// Fails t for every pipe line under root that can't be evaluated and every assertion
+// that fails, reported as file:line:col: message.
+func Run(t testing.TB, root string, options Options) {
+	t.Helper()
+	files, err := check.Find([]string{root}, options.Include, slices.Concat(options.Ignore, check.DefaultIgnore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converters := options.Converters
+	if converters == nil {
+		exchangeRates := unit.NewExchangeRates()
+		t.Cleanup(exchangeRates.Close)
+		converters = &unit.Converters{
+			ConvertCurrency:  exchangeRates.Converter(),
+			ConvertFixedUnit: unit.GetFixedUnitConverter(),
+		}
+	}
+	in := interpreter.NewInterpreter(t.Context(), converters)
+	in.SetOptions(interpreter.FileOptions())
+
+	for _, file := range files {
+		problems, err := check.File(t.Context(), in, file)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, problem := range problems {
+			t.Errorf("%s:%d:%d: %s", problem.Path, problem.Line, problem.Column, problem.Message)
+		}
+	}
+}
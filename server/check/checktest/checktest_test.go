@@ -0,0 +1,69 @@
+package checktest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"puter/unit"
+	"testing"
+)
+
+// Records the errors Run reports instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Error(args ...any) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func TestRun(t *testing.T) {
+	root := t.TempDir()
+	docs := map[string]string{
+		"capacity.md": "// | nodes = 12\n// | assert nodes * 64 == 768\n// | weight = 24 kg\n// | weight < 20 kg ?\n",
+		"budget.md":   "// | rent = 1000 usd\n// | assert rent in eur == 900 eur\n",
+		"notes.txt":   "// | broken +\n",
+	}
+	for name, content := range docs {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	converters := &unit.Converters{
+		ConvertCurrency: func(fromValue float64, fromUnit string, toUnit string) (float64, error) {
+			if fromUnit == toUnit {
+				return fromValue, nil
+			}
+			return fromValue * 0.9, nil
+		},
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+
+	recorder := &recordingTB{TB: t}
+	Run(recorder, root, Options{Include: []string{"*.md"}, Converters: converters})
+	expected := filepath.Join(root, "capacity.md") + ":4:6: Assertion failed: expected < 20 kilograms, got 24 kilograms"
+	if len(recorder.errors) != 1 || recorder.errors[0] != expected {
+		t.Errorf("expected only %q, got %q", expected, recorder.errors)
+	}
+}
+
+func TestRunKeepsTheIgnoredGlobs(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "notes.md"), []byte("// | 1 + 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Room to spare behind the globs of the caller, which Run must not write into.
+	ignore := make([]string, 1, 10)
+	ignore[0] = "drafts/**"
+	Run(t, root, Options{Ignore: ignore})
+	if spare := ignore[:2][1]; spare != "" {
+		t.Errorf("expected the globs of the caller to stay as they were, got %q after them", spare)
+	}
+}
@@ -0,0 +1,141 @@
+package check
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// Writes a problem per line like compilers do, `docs/budget.md:12:8: message`.
+func WriteText(w io.Writer, problems []*Problem) error {
+	for _, problem := range problems {
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s\n", problem.Path, problem.Line, problem.Column, problem.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The rules problems belong to, one for lines that can't be evaluated and one for
+// assertions that failed.
+const (
+	sarifEvaluationRuleID = "puter/evaluation"
+	sarifAssertionRuleID  = "puter/assertion"
+)
+
+// The parts of SARIF 2.1.0 that code scanning needs.
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool      `json:"tool"`
+	ColumnKind string         `json:"columnKind"`
+	Results    []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// Writes the problems as a SARIF log, for code scanning to show them on the lines they
+// are about. Paths are written as they were found, relative to where puter ran.
+func WriteSARIF(w io.Writer, problems []*Problem) error {
+	run := &sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "puter",
+			InformationURI: "https://github.com/Khongchai/puter",
+			Rules: []*sarifRule{
+				{
+					ID:               sarifEvaluationRuleID,
+					ShortDescription: sarifMessage{Text: "A pipe line could not be evaluated"},
+				},
+				{
+					ID:               sarifAssertionRuleID,
+					ShortDescription: sarifMessage{Text: "An assertion of a pipe line failed"},
+				},
+			},
+		}},
+		// Problems count characters, not the UTF-16 code units SARIF counts by default.
+		ColumnKind: "unicodeCodePoints",
+		Results:    []*sarifResult{},
+	}
+	for _, problem := range problems {
+		ruleID := sarifEvaluationRuleID
+		if problem.Assertion {
+			ruleID = sarifAssertionRuleID
+		}
+		run.Results = append(run.Results, &sarifResult{
+			RuleID:  ruleID,
+			Level:   "error",
+			Message: sarifMessage{Text: problem.Message},
+			Locations: []*sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(filepath.Clean(problem.Path))},
+				Region: sarifRegion{
+					StartLine:   problem.Line,
+					StartColumn: problem.Column,
+					EndLine:     problem.EndLine,
+					// SARIF regions end after their last character, at least one character.
+					EndColumn: max(problem.EndColumn, problem.Column+1),
+				},
+			}}},
+		})
+	}
+	log := &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []*sarifRun{run},
+	}
+	if err := json.MarshalWrite(w, log, jsontext.WithIndent("  ")); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
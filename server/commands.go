@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"puter/annotate"
+	"puter/check"
+	"puter/interpreter"
+	"puter/repl"
+	"puter/report"
+	"puter/unit"
+	"strings"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// Commands run as `puter <command> [flags]` instead of the language server.
+var commands = map[string]func(args []string) int{
+	"repl":  runRepl,
+	"eval":  runEval,
+	"check": runCheck,
+}
+
+// Converters for a command, rates are fetched as they are needed. The returned
+// function stops fetching them.
+func newConverters() (*unit.Converters, func()) {
+	exchangeRates := unit.NewExchangeRates()
+	converters := &unit.Converters{
+		ConvertCurrency:  exchangeRates.Converter(),
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+	return converters, exchangeRates.Close
+}
+
+func runRepl(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	history := flags.String("history", repl.DefaultHistoryFile(), "keep the input in this file between sessions, empty to not keep it")
+	flags.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	converters, closeConverters := newConverters()
+	defer closeConverters()
+	if err := repl.Run(ctx, converters, os.Stdin, os.Stdout, repl.Options{HistoryFile: *history}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// The output of `puter eval --json`.
+type evalOutput struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	Files         []*evalFile `json:"files"`
+}
+
+type evalFile struct {
+	Path  string         `json:"path"`
+	Lines []*report.Line `json:"lines"`
+}
+
+func runEval(args []string) int {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the results as JSON, in the schema of puter/evaluate")
+	write := flags.Bool("write", false, "write the result of every pipe line into the file, as // | expr  => result")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: puter eval [--json] [--write] <file>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	converters, closeConverters := newConverters()
+	defer closeConverters()
+	in := interpreter.NewInterpreter(ctx, converters)
+	in.SetOptions(interpreter.FileOptions())
+
+	exitCode := 0
+	output := &evalOutput{SchemaVersion: report.SchemaVersion, Files: []*evalFile{}}
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		text := string(content)
+		interpretations, err := in.ReinterpretLanguage(ctx, interpreter.LanguageOfFile(path), nil, text)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if *write {
+			if written := annotate.Write(text, interpretations); written != text {
+				if err := os.WriteFile(path, []byte(written), info.Mode()); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					exitCode = 1
+				}
+			}
+		}
+		switch {
+		case *asJSON:
+			file := &evalFile{Path: path, Lines: []*report.Line{}}
+			for _, interpretation := range interpretations {
+				file.Lines = append(file.Lines, report.NewLine(interpretation))
+			}
+			output.Files = append(output.Files, file)
+		case !*write:
+			fmt.Print(annotate.Columns(path, text, interpretations))
+		}
+	}
+
+	if *asJSON {
+		if err := json.MarshalWrite(os.Stdout, output, jsontext.WithIndent("  ")); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println()
+	}
+	return exitCode
+}
+
+// A flag that can be given more than once, every value can hold several separated by commas.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	include := listFlag{}
+	flags.Var(&include, "include", "only check files matching this glob, like *.md or docs/**/*.md, can be repeated")
+	ignore := listFlag{}
+	flags.Var(&ignore, "ignore", "skip files and directories matching this glob, can be repeated")
+	format := flags.String("format", "text", "how problems are printed: text, as file:line:col: message, or sarif")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: puter check [--include glob] [--ignore glob] [--format text|sarif] [dir|file]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != "text" && *format != "sarif" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text or sarif\n", *format)
+		return 2
+	}
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	files, err := check.Find(roots, include, append(ignore, check.DefaultIgnore...))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	converters, closeConverters := newConverters()
+	defer closeConverters()
+	in := interpreter.NewInterpreter(ctx, converters)
+	in.SetOptions(interpreter.FileOptions())
+
+	exitCode := 0
+	problems := []*check.Problem{}
+	for _, file := range files {
+		found, err := check.File(ctx, in, file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 2
+			continue
+		}
+		problems = append(problems, found...)
+	}
+
+	if *format == "sarif" {
+		err = check.WriteSARIF(os.Stdout, problems)
+	} else {
+		err = check.WriteText(os.Stdout, problems)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if exitCode == 0 && len(problems) > 0 {
+		exitCode = 1
+	}
+	return exitCode
+}
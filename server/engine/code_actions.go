@@ -0,0 +1,494 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"puter/evaluation/ast"
+	"puter/evaluation/evaluator"
+	"puter/evaluation/evaluator/box"
+	"puter/evaluation/parser"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Command that applies the workspace edit passed as its only argument through `workspace/applyEdit`.
+const applyEditCommand = "puter.applyEdit"
+
+// An edit to a single pipe line, turned into a code action once the client capabilities are known.
+type lineEdit struct {
+	title      string
+	kind       lsproto.CodeActionKind
+	edits      []*lsproto.TextEdit
+	diagnostic *lsproto.Diagnostic
+	preferred  bool
+}
+
+func (e *Engine) handleCodeAction(ctx context.Context, params *lsproto.CodeActionParams, _ *lsproto.RequestMessage) (lsproto.CodeActionResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.CodeActionResponse{}, nil
+	}
+
+	lineEdits := []*lineEdit{}
+	for _, interpretation := range doc.interpretations {
+		line := uint32(interpretation.LineIndex)
+		if line < params.Range.Start.Line || line > params.Range.End.Line {
+			continue
+		}
+		lineEdits = append(lineEdits, quickFixes(doc, interpretation, params.Range)...)
+		// Rewrites only make sense for the line the cursor is on, not for every line of a selection.
+		if params.Range.Start.Line == params.Range.End.Line {
+			lineEdits = append(lineEdits, rewrites(doc, interpretation)...)
+		}
+	}
+
+	var only []lsproto.CodeActionKind
+	if params.Context != nil && params.Context.Only != nil {
+		only = *params.Context.Only
+	}
+	caps := lsproto.GetClientCapabilities(ctx)
+
+	actions := []lsproto.CommandOrCodeAction{}
+	for _, lineEdit := range lineEdits {
+		if !kindRequested(lineEdit.kind, only) {
+			continue
+		}
+		action := &lsproto.CodeAction{
+			Title: lineEdit.title,
+			Kind:  utils.PointerTo(lineEdit.kind),
+		}
+		if lineEdit.diagnostic != nil {
+			action.Diagnostics = &[]*lsproto.Diagnostic{lineEdit.diagnostic}
+		}
+		if lineEdit.preferred {
+			action.IsPreferred = utils.PointerTo(true)
+		}
+
+		edit := workspaceEdit(doc, lineEdit.edits, caps.Workspace.WorkspaceEdit.DocumentChanges)
+		if caps.Workspace.ApplyEdit {
+			action.Command = &lsproto.Command{
+				Title:     lineEdit.title,
+				Command:   applyEditCommand,
+				Arguments: &[]any{edit},
+			}
+		} else {
+			// Without `workspace/applyEdit` the client can still apply the edit itself.
+			action.Edit = edit
+		}
+		actions = append(actions, lsproto.CommandOrCodeAction{CodeAction: action})
+	}
+
+	if action := evaluateSelectionAction(doc, params.Range); action != nil && kindRequested(*action.Kind, only) {
+		actions = append(actions, lsproto.CommandOrCodeAction{CodeAction: action})
+	}
+
+	return lsproto.CodeActionResponse{CommandOrCodeActionArray: &actions}, nil
+}
+
+// Reports whether kind was asked for. Kinds are hierarchical, asking for `refactor`
+// includes `refactor.rewrite`.
+func kindRequested(kind lsproto.CodeActionKind, only []lsproto.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(string(kind), string(requested)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Wraps edits to doc in a workspace edit. When the client supports versioned document changes
+// the edit carries the version it was computed for, so that it is rejected if the document
+// changed in the meantime.
+func workspaceEdit(doc *document, edits []*lsproto.TextEdit, documentChanges bool) *lsproto.WorkspaceEdit {
+	if !documentChanges {
+		return &lsproto.WorkspaceEdit{
+			Changes: &map[lsproto.DocumentUri][]*lsproto.TextEdit{doc.uri: edits},
+		}
+	}
+	textEdits := []lsproto.TextEditOrAnnotatedTextEditOrSnippetTextEdit{}
+	for _, edit := range edits {
+		textEdits = append(textEdits, lsproto.TextEditOrAnnotatedTextEditOrSnippetTextEdit{TextEdit: edit})
+	}
+	return &lsproto.WorkspaceEdit{
+		DocumentChanges: &[]lsproto.TextDocumentEditOrCreateFileOrRenameFileOrDeleteFile{
+			{
+				TextDocumentEdit: &lsproto.TextDocumentEdit{
+					TextDocument: lsproto.OptionalVersionedTextDocumentIdentifier{
+						Uri:     doc.uri,
+						Version: lsproto.IntegerOrNull{Integer: &doc.version},
+					},
+					Edits: textEdits,
+				},
+			},
+		},
+	}
+}
+
+func (e *Engine) executeApplyEdit(ctx context.Context, arguments []any) (any, error) {
+	edit := &lsproto.WorkspaceEdit{}
+	if err := decodeArgument(applyEditCommand, arguments, edit); err != nil {
+		return nil, err
+	}
+
+	result, err := sendClientRequest(ctx, e, lsproto.WorkspaceApplyEditInfo, &lsproto.ApplyWorkspaceEditParams{
+		Label: utils.PointerTo("puter"),
+		Edit:  edit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || !result.Applied {
+		reason := "no reason given"
+		if result != nil && result.FailureReason != nil {
+			reason = *result.FailureReason
+		}
+		return nil, fmt.Errorf("%w: edit was not applied: %s", lsproto.ErrorCodeRequestFailed, reason)
+	}
+	return nil, nil
+}
+
+// Edits that rewrite a pipe line using its result.
+func rewrites(doc *document, interpretation *interpreter.Interpretation) []*lineEdit {
+	if interpretation.Box == nil || len(interpretation.Diagnostics) > 0 {
+		return nil
+	}
+	lineEdits := []*lineEdit{}
+	line := doc.line(interpretation.LineIndex)
+	start, end := expressionBounds(interpretation)
+	tokens := scanTokens(interpretation.Text)
+
+	// Accumulation commands have no expression to replace, only their result can be kept.
+	isCommand := interpreter.IsAccumulationCommand(strings.TrimSpace(interpretation.Text))
+
+	// An assertion replaced by its result would no longer check anything.
+	if literal := boxLiteral(interpretation.Box); literal != "" && !isCommand && interpretation.Assertion == nil {
+		valueStart := start
+		if _, isAssignment := parseLine(interpretation.Text).(*ast.AssignExpression); isAssignment {
+			for i, token := range tokens {
+				if token.Type == ast.ASSIGN && i+1 < len(tokens) {
+					valueStart = tokens[i+1].StartPos()
+					break
+				}
+			}
+		}
+		if interpretation.Text[valueStart:end] != literal {
+			lineEdits = append(lineEdits, &lineEdit{
+				title: "Insert result as literal",
+				kind:  lsproto.CodeActionKindRefactorInline,
+				edits: []*lsproto.TextEdit{{
+					Range:   lineRange(interpretation, valueStart, end),
+					NewText: literal,
+				}},
+			})
+		}
+	}
+
+	// The comment goes on a new line below, with the same comment marker as the pipe line
+	// but without the pipe so that it is not evaluated, and closed like the pipe line is.
+	comment := strings.TrimRight(line[:interpretation.Column-1], " ") + " = " + interpretation.EvalResult
+	if interpretation.Suffix != "" {
+		comment += " " + interpretation.Suffix
+	}
+	lineEnd := lsproto.Position{Line: uint32(interpretation.LineIndex), Character: uint32(len(line))}
+	lineEdits = append(lineEdits, &lineEdit{
+		title: "Append result as comment",
+		kind:  lsproto.CodeActionKindRefactor,
+		edits: []*lsproto.TextEdit{{
+			Range:   lsproto.Range{Start: lineEnd, End: lineEnd},
+			NewText: doc.lineBreak() + comment,
+		}},
+	})
+
+	if fixed, ok := interpretation.Box.(*box.FixedUnitBox); ok && !isCommand {
+		// Replace the unit of a trailing `in <unit>`, otherwise add a conversion.
+		replaceFrom, replaceTo, prefix := end, end, " in "
+		if n := len(tokens); n >= 2 && tokens[n-2].Type == ast.IN && tokens[n-1].Type == ast.IDENT {
+			replaceFrom, replaceTo, prefix = tokens[n-1].StartPos(), tokens[n-1].EndPos(), ""
+		}
+		for _, target := range compatibleUnits(fixed.FixedUnitType) {
+			lineEdits = append(lineEdits, &lineEdit{
+				title: fmt.Sprintf("Convert to %s", target),
+				kind:  lsproto.CodeActionKindRefactorRewrite,
+				edits: []*lsproto.TextEdit{{
+					Range:   lineRange(interpretation, replaceFrom, replaceTo),
+					NewText: prefix + string(target),
+				}},
+			})
+		}
+	}
+
+	return lineEdits
+}
+
+// Quick-fixes for the diagnostics of a pipe line within rng: identifiers that are neither
+// a known unit nor a known variable are replaced with the closest known name.
+func quickFixes(doc *document, interpretation *interpreter.Interpretation, rng lsproto.Range) []*lineEdit {
+	lineEdits := []*lineEdit{}
+	tokens := scanTokens(interpretation.Text)
+	// A single unknown name often causes several diagnostics, it only needs fixing once.
+	fixed := map[*ast.Token]bool{}
+	for _, diagnostic := range interpretation.Diagnostics {
+		if lsproto.ComparePositions(diagnostic.Range.End, rng.Start) < 0 || lsproto.ComparePositions(diagnostic.Range.Start, rng.End) > 0 {
+			continue
+		}
+		from := int(diagnostic.Range.Start.Character) - interpretation.Column
+		to := int(diagnostic.Range.End.Character) - interpretation.Column
+
+		for i, token := range tokens {
+			if token.Type != ast.IDENT || token.StartPos() < from || token.EndPos() > to || fixed[token] {
+				continue
+			}
+			var candidates []string
+			switch {
+			case i > 0 && slices.Contains([]ast.TokenType{ast.NUMBER, ast.RPAREN, ast.IN}, tokens[i-1].Type):
+				if isKnownUnit(token.Literal) {
+					continue
+				}
+				candidates = unitNames(lineFamilies(tokens))
+			case i+1 < len(tokens) && tokens[i+1].Type == ast.LPAREN:
+				if _, ok := evaluator.Builtins[token.Literal]; ok {
+					continue
+				}
+				candidates = slices.Collect(maps.Keys(evaluator.Builtins))
+			default:
+				if !isUndefinedRead(interpretation, token) {
+					continue
+				}
+				candidates = variableNames(doc, interpretation.LineIndex)
+			}
+
+			fixed[token] = true
+			for j, suggestion := range closest(token.Literal, candidates, 3) {
+				lineEdits = append(lineEdits, &lineEdit{
+					title: fmt.Sprintf("Change '%s' to '%s'", token.Literal, suggestion),
+					kind:  lsproto.CodeActionKindQuickFix,
+					edits: []*lsproto.TextEdit{{
+						Range:   lineRange(interpretation, token.StartPos(), token.EndPos()),
+						NewText: suggestion,
+					}},
+					diagnostic: diagnostic,
+					preferred:  j == 0,
+				})
+			}
+		}
+	}
+	return lineEdits
+}
+
+// Returns the start and end of the evaluated text without surrounding whitespace,
+// relative to the text like evaluator positions.
+func expressionBounds(interpretation *interpreter.Interpretation) (int, int) {
+	text := interpretation.Text
+	start := len(text) - len(strings.TrimLeft(text, " \t"))
+	end := len(strings.TrimRight(text, " \t\r"))
+	return start, max(start, end)
+}
+
+func lineRange(interpretation *interpreter.Interpretation, start int, end int) lsproto.Range {
+	line := uint32(interpretation.LineIndex)
+	return lsproto.Range{
+		Start: lsproto.Position{Line: line, Character: uint32(interpretation.Column + start)},
+		End:   lsproto.Position{Line: line, Character: uint32(interpretation.Column + end)},
+	}
+}
+
+func parseLine(text string) ast.Expression {
+	expression, err := parser.NewParser().Parse(text)
+	if err != nil {
+		return nil
+	}
+	return expression
+}
+
+// Writes a box back as puter source that evaluates to the same box.
+// Returns an empty string for boxes that have no literal form.
+func boxLiteral(value box.Box) string {
+	switch v := value.(type) {
+	case *box.NumberBox:
+		return numberLiteral(v)
+	case *box.FixedUnitBox:
+		return numberLiteral(v.Number) + " " + string(v.FixedUnitType)
+	case *box.CurrencyBox:
+		return numberLiteral(v.Number) + " " + v.Unit
+	case *box.PercentBox:
+		return strconv.FormatFloat(v.Value, 'f', -1, 64) + "%"
+	case *box.BooleanBox:
+		return v.Inspect()
+	default:
+		return ""
+	}
+}
+
+func numberLiteral(number *box.NumberBox) string {
+	switch number.NumberType {
+	case box.NaN:
+		return ""
+	case box.Hex, box.Binary:
+		return number.Inspect()
+	default:
+		// %g would write large numbers with an exponent, which does not scan as a number.
+		return strconv.FormatFloat(number.Value, 'f', -1, 64)
+	}
+}
+
+// Units of the same family as from, length for km, mass for kg, without from itself.
+// Only short names are returned, kilometers and kilometer are the same unit as km.
+func compatibleUnits(from unit.FixedUnitType) []unit.FixedUnitType {
+	detail, ok := unit.FixedUnitTypes[from]
+	if !ok {
+		return nil
+	}
+	units := []unit.FixedUnitType{}
+	for key, candidate := range unit.FixedUnitTypes {
+		if candidate == detail || candidate.UnitFor != detail.UnitFor {
+			continue
+		}
+		if string(key) == candidate.FullName || string(key) == candidate.FullNameSingular {
+			continue
+		}
+		// `in` for inches reads as the conversion keyword.
+		if !isIdentifier(string(key)) {
+			continue
+		}
+		units = append(units, key)
+	}
+	slices.Sort(units)
+	return units
+}
+
+func isKnownUnit(name string) bool {
+	if ok, _ := box.IsNumberKeyword(name); ok {
+		return true
+	}
+	if ok, _ := unit.IsFixedUnitKeyword(name); ok {
+		return true
+	}
+	_, ok := unit.FiatCurrencies[strings.ToUpper(name)]
+	return ok
+}
+
+// Returns the names of every known unit. When families is not empty, only fixed units
+// of those families are returned, a typo next to km is much more likely a length than a currency.
+func unitNames(families map[string]bool) []string {
+	names := []string{}
+	for key, detail := range unit.FixedUnitTypes {
+		if len(families) == 0 || families[detail.UnitFor] {
+			names = append(names, string(key))
+		}
+	}
+	if len(families) > 0 {
+		return names
+	}
+	for code := range unit.FiatCurrencies {
+		names = append(names, strings.ToLower(code))
+	}
+	return names
+}
+
+// Families of the fixed units used on a line.
+func lineFamilies(tokens []*ast.Token) map[string]bool {
+	families := map[string]bool{}
+	for _, token := range tokens {
+		if ok, fixedUnitType := unit.IsFixedUnitKeyword(token.Literal); ok && token.Type == ast.IDENT {
+			families[unit.FixedUnitTypes[fixedUnitType].UnitFor] = true
+		}
+	}
+	return families
+}
+
+// Reports whether token is read on the line without having a value.
+func isUndefinedRead(interpretation *interpreter.Interpretation, token *ast.Token) bool {
+	for _, binding := range interpretation.Bindings {
+		if binding.StartPos == token.StartPos() && !binding.Assigned {
+			return binding.Value == nil
+		}
+	}
+	return false
+}
+
+// Names of the variables assigned above lineIndex, including the predefined ones.
+func variableNames(doc *document, lineIndex int) []string {
+	names := []string{"pi", "e"}
+	for _, item := range variableCompletions(doc, lineIndex) {
+		names = append(names, item.Label)
+	}
+	return names
+}
+
+// Returns up to limit candidates closest to name by edit distance, closest first.
+// Candidates that share too little with name to be a typo of it are left out.
+func closest(name string, candidates []string, limit int) []string {
+	type scored struct {
+		name     string
+		distance int
+	}
+	lowered := strings.ToLower(name)
+	maxDistance := max(1, (len(name)+1)/2)
+	found := []scored{}
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(lowered, strings.ToLower(candidate)); d <= maxDistance {
+			found = append(found, scored{candidate, d})
+		}
+	}
+	slices.SortFunc(found, func(a, b scored) int {
+		if a.distance != b.distance {
+			return a.distance - b.distance
+		}
+		// Typos rarely get the first letter wrong.
+		if aFirst, bFirst := sameFirstLetter(lowered, a.name), sameFirstLetter(lowered, b.name); aFirst != bFirst {
+			if aFirst {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.name, b.name)
+	})
+
+	names := []string{}
+	for _, s := range found {
+		if len(names) == limit {
+			break
+		}
+		if !slices.Contains(names, s.name) {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+func sameFirstLetter(lowered string, candidate string) bool {
+	return lowered != "" && candidate != "" && lowered[0] == strings.ToLower(candidate)[0]
+}
+
+// Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Returns the code actions for rng by title.
+func codeActions(t *testing.T, ctx context.Context, e *Engine, rng lsproto.Range, only ...lsproto.CodeActionKind) map[string]*lsproto.CodeAction {
+	t.Helper()
+	params := &lsproto.CodeActionParams{TextDocument: textDocument(), Range: rng, Context: &lsproto.CodeActionContext{}}
+	if len(only) > 0 {
+		params.Context.Only = &only
+	}
+	response, err := e.handleCodeAction(ctx, params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]*lsproto.CodeAction{}
+	for _, action := range *response.CommandOrCodeActionArray {
+		actions[action.CodeAction.Title] = action.CodeAction
+	}
+	return actions
+}
+
+// Returns text with the edits of an action that carries its edit applied.
+func applyAction(t *testing.T, text string, action *lsproto.CodeAction) string {
+	t.Helper()
+	if action == nil || action.Edit == nil || action.Edit.Changes == nil {
+		t.Fatalf("expected an action with changes, got %+v", action)
+	}
+	edits := slices.Clone((*action.Edit.Changes)[testUri])
+	slices.SortFunc(edits, func(a, b *lsproto.TextEdit) int {
+		return cmp.Compare(lsproto.ComparePositions(b.Range.Start, a.Range.Start), 0)
+	})
+	lines := strings.Split(text, "\n")
+	for _, edit := range edits {
+		start, end := edit.Range.Start, edit.Range.End
+		if start.Line != end.Line {
+			t.Fatalf("expected edits within a line, got %v", edit.Range)
+		}
+		line := lines[start.Line]
+		lines[start.Line] = line[:start.Character] + edit.NewText + line[end.Character:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The whole of a line, like a client that asks for the actions of every diagnostic on it.
+func lineRangeOf(line uint32) lsproto.Range {
+	return lsproto.Range{Start: position(line, 0), End: position(line, 100)}
+}
+
+func TestQuickFixes(t *testing.T) {
+	cases := []struct {
+		text      string
+		line      uint32
+		preferred string
+		expected  string
+	}{
+		{"// | 3 km in metr", 0, "Change 'metr' to 'meter'", "// | 3 km in meter"},
+		{"// | distance = 2\n// | distanse * 2", 1, "Change 'distanse' to 'distance'", "// | distance = 2\n// | distance * 2"},
+		{"// | sqr(4)", 0, "Change 'sqr' to 'sqrt'", "// | sqrt(4)"},
+	}
+	for _, c := range cases {
+		e := newTestEngine(t)
+		openTestDocument(e, c.text)
+		actions := codeActions(t, t.Context(), e, lineRangeOf(c.line), lsproto.CodeActionKindQuickFix)
+		action := actions[c.preferred]
+		if action == nil || action.IsPreferred == nil || !*action.IsPreferred {
+			t.Errorf("%q: expected %q to be preferred among %v", c.text, c.preferred, slices.Sorted(maps.Keys(actions)))
+			continue
+		}
+		if action.Diagnostics == nil || len(*action.Diagnostics) != 1 {
+			t.Errorf("%q: expected the fix to name its diagnostic", c.text)
+		}
+		if fixed := applyAction(t, c.text, action); fixed != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.text, c.expected, fixed)
+		}
+	}
+}
+
+func TestRewrites(t *testing.T) {
+	text := "// | x = 3 km in m\n// | sum\n"
+	e := newTestEngine(t)
+	openTestDocument(e, text)
+
+	actions := codeActions(t, t.Context(), e, lineRangeOf(0))
+	cases := map[string]string{
+		"Insert result as literal": "// | x = 3000 m\n// | sum\n",
+		"Append result as comment": "// | x = 3 km in m\n// = 3000 meters\n// | sum\n",
+		"Convert to cm":            "// | x = 3 km in cm\n// | sum\n",
+	}
+	for title, expected := range cases {
+		if rewritten := applyAction(t, text, actions[title]); rewritten != expected {
+			t.Errorf("%s: expected %q, got %q", title, expected, rewritten)
+		}
+	}
+	if _, ok := actions["Convert to kg"]; ok {
+		t.Errorf("expected conversions to lengths only")
+	}
+
+	// An accumulation has no expression to replace.
+	actions = codeActions(t, t.Context(), e, lineRangeOf(1))
+	if _, ok := actions["Insert result as literal"]; ok {
+		t.Errorf("expected no literal for sum")
+	}
+	if _, ok := actions["Append result as comment"]; !ok {
+		t.Errorf("expected the result of sum to be appended")
+	}
+
+	// Rewrites are for the line of the cursor, not every line of a selection.
+	actions = codeActions(t, t.Context(), e, lsproto.Range{Start: position(0, 0), End: position(1, 0)})
+	if len(actions) != 0 {
+		t.Errorf("expected no rewrites for a selection, got %v", slices.Sorted(maps.Keys(actions)))
+	}
+}
+
+func TestRewritesKeepClosingMarkers(t *testing.T) {
+	text := "<!-- | 3 km in m -->"
+	e := newTestEngine(t)
+	doc := &document{uri: testUri, version: 1, text: text}
+	interpretations, err := e.interpreter.ReinterpretLanguage(t.Context(), "html", nil, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.interpretations = interpretations
+	e.documents.set(doc)
+
+	expected := "<!-- | 3 km in m -->\n<!-- = 3000 meters -->"
+	if appended := applyAction(t, text, codeActions(t, t.Context(), e, lineRangeOf(0))["Append result as comment"]); appended != expected {
+		t.Errorf("expected %q, got %q", expected, appended)
+	}
+}
+
+func TestRewritesOfAssertions(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, "// | assert 3 km < 4 km")
+	actions := codeActions(t, t.Context(), e, lineRangeOf(0))
+	if _, ok := actions["Insert result as literal"]; ok {
+		t.Errorf("expected no literal in place of an assertion")
+	}
+	if _, ok := actions["Append result as comment"]; !ok {
+		t.Errorf("expected the result of the assertion to be appended, got %v", slices.Sorted(maps.Keys(actions)))
+	}
+}
+
+func TestCodeActionsOnlyRequestedKinds(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, "// | 3 km")
+	for title, action := range codeActions(t, t.Context(), e, lineRangeOf(0), lsproto.CodeActionKindRefactor) {
+		if !strings.HasPrefix(string(*action.Kind), "refactor") {
+			t.Errorf("%s: expected a refactor, got %s", title, *action.Kind)
+		}
+	}
+	if actions := codeActions(t, t.Context(), e, lineRangeOf(0), lsproto.CodeActionKindRefactorRewrite); actions["Append result as comment"] != nil || actions["Convert to m"] == nil {
+		t.Errorf("expected only rewrites, got %v", slices.Sorted(maps.Keys(actions)))
+	}
+}
+
+func TestCodeActionsThroughApplyEdit(t *testing.T) {
+	e := newTestEngine(t)
+	doc := openTestDocument(e, "// | 3 km")
+	ctx := lsproto.WithClientCapabilities(t.Context(), &lsproto.ResolvedClientCapabilities{
+		Workspace: lsproto.ResolvedWorkspaceClientCapabilities{
+			ApplyEdit:     true,
+			WorkspaceEdit: lsproto.ResolvedWorkspaceEditClientCapabilities{DocumentChanges: true},
+		},
+	})
+	action := codeActions(t, ctx, e, lineRangeOf(0))["Convert to m"]
+	if action.Edit != nil || action.Command == nil || action.Command.Command != applyEditCommand {
+		t.Fatalf("expected the edit to go through %s, got %+v", applyEditCommand, action)
+	}
+	edit := (*action.Command.Arguments)[0].(*lsproto.WorkspaceEdit)
+	change := (*edit.DocumentChanges)[0].TextDocumentEdit
+	if *change.TextDocument.Version.Integer != doc.version {
+		t.Errorf("expected the edit to be for version %d, got %d", doc.version, *change.TextDocument.Version.Integer)
+	}
+}
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"km", "kg", "m", "cm", "mile"}
+	cases := map[string][]string{
+		"kmm":   {"km", "kg", "cm"},
+		"mle":   {"mile", "m"},
+		"xyzzy": {},
+	}
+	for name, expected := range cases {
+		if got := closest(name, candidates, 3); !slices.Equal(got, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+}
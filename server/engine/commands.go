@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	lsproto "puter/lsp"
+	"slices"
+
+	"github.com/go-json-experiment/json"
+)
+
+type commandMap map[string]func(*Engine, context.Context, []any) (any, error)
+
+// Commands the client can run with `workspace/executeCommand`, keyed by command name.
+var commands = commandMap{
+	applyEditCommand:         (*Engine).executeApplyEdit,
+	evaluateCommand:          (*Engine).executeEvaluate,
+	evaluateSelectionCommand: (*Engine).executeEvaluateSelection,
+}
+
+func commandNames() []string {
+	return slices.Sorted(maps.Keys(commands))
+}
+
+func (e *Engine) handleExecuteCommand(ctx context.Context, params *lsproto.ExecuteCommandParams, _ *lsproto.RequestMessage) (lsproto.ExecuteCommandResponse, error) {
+	command, ok := commands[params.Command]
+	if !ok {
+		return lsproto.ExecuteCommandResponse{}, fmt.Errorf("%w: unknown command %q", lsproto.ErrorCodeInvalidParams, params.Command)
+	}
+	var arguments []any
+	if params.Arguments != nil {
+		arguments = *params.Arguments
+	}
+	result, err := command(e, ctx, arguments)
+	if err != nil || result == nil {
+		return lsproto.ExecuteCommandResponse{}, err
+	}
+	return lsproto.ExecuteCommandResponse{LSPAny: &result}, nil
+}
+
+// Decodes the only argument of command into target.
+func decodeArgument(command string, arguments []any, target any) error {
+	if len(arguments) != 1 {
+		return fmt.Errorf("%w: %s expects a single argument, got %d", lsproto.ErrorCodeInvalidParams, command, len(arguments))
+	}
+	return decodeValue(command, arguments[0], target)
+}
+
+// Decodes value into target. Command arguments and the params of custom methods arrive as
+// plain JSON values rather than the types they stand for. name is the command or method
+// the value is for, to tell where an invalid value came from.
+func decodeValue(name string, value any, target any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("%w: %w", lsproto.ErrorCodeInvalidParams, err)
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("%w: %s: %w", lsproto.ErrorCodeInvalidParams, name, err)
+	}
+	return nil
+}
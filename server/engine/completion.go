@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"puter/evaluation/ast"
+	"puter/evaluation/evaluator"
+	"puter/evaluation/evaluator/box"
+	"puter/evaluation/scanner"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+	"slices"
+	"strings"
+)
+
+func (e *Engine) handleCompletion(ctx context.Context, params *lsproto.CompletionParams, _ *lsproto.RequestMessage) (lsproto.CompletionResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.CompletionResponse{}, nil
+	}
+	lineIndex := int(params.Position.Line)
+	interpretation := doc.interpretationAt(lineIndex)
+	if interpretation == nil {
+		return lsproto.CompletionResponse{}, nil
+	}
+
+	line := doc.line(lineIndex)
+	cursor := min(int(params.Position.Character), len(line))
+	if cursor < interpretation.Column {
+		return lsproto.CompletionResponse{}, nil
+	}
+
+	var items []*lsproto.CompletionItem
+	if expectsUnit(line[interpretation.Column:cursor]) {
+		items = append(items, unitCompletions()...)
+	} else {
+		items = append(items, variableCompletions(doc, lineIndex)...)
+		items = append(items, builtinCompletions()...)
+	}
+
+	return lsproto.CompletionResponse{
+		List: &lsproto.CompletionList{
+			IsIncomplete: false,
+			Items:        items,
+		},
+	}, nil
+}
+
+// Reports whether the text before the cursor ends at a position where a unit is expected,
+// which is right after `in`, a number, or a closing paren. A partially typed word is skipped over.
+//
+//	2 in k|   -> true
+//	20 |      -> true
+//	sqrt(2) | -> true
+//	1 + |     -> false
+func expectsUnit(beforeCursor string) bool {
+	tokens := scanTokens(beforeCursor)
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		typingWord := (last.Type == ast.IDENT || last.Type == ast.IN) && last.EndPos() == len(beforeCursor)
+		if typingWord {
+			tokens = tokens[:len(tokens)-1]
+		}
+	}
+	if len(tokens) == 0 {
+		return false
+	}
+
+	switch tokens[len(tokens)-1].Type {
+	case ast.IN, ast.NUMBER, ast.RPAREN:
+		return true
+	}
+	return false
+}
+
+// Returns the tokens of text up to, but not including, EOF.
+func scanTokens(text string) []*ast.Token {
+	s := scanner.NewScanner(text)
+	tokens := []*ast.Token{}
+	for {
+		token := s.Next()
+		if token.Type == ast.EOF {
+			return tokens
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+func unitCompletions() []*lsproto.CompletionItem {
+	items := []*lsproto.CompletionItem{
+		{
+			Label:  "in",
+			Kind:   utils.PointerTo(lsproto.CompletionItemKindKeyword),
+			Detail: utils.PointerTo("convert to another unit"),
+		},
+	}
+
+	for _, numberType := range []box.NumberType{box.Decimal, box.Hex, box.Binary} {
+		items = append(items, &lsproto.CompletionItem{
+			Label:  string(numberType),
+			Kind:   utils.PointerTo(lsproto.CompletionItemKindUnit),
+			Detail: utils.PointerTo("number format"),
+		})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(unit.FixedUnitTypes)) {
+		detail := unit.FixedUnitTypes[key]
+		items = append(items, &lsproto.CompletionItem{
+			Label:  string(key),
+			Kind:   utils.PointerTo(lsproto.CompletionItemKindUnit),
+			Detail: utils.PointerTo(fmt.Sprintf("%s (%s)", detail.FullName, detail.UnitFor)),
+		})
+	}
+
+	for _, code := range slices.Sorted(maps.Keys(unit.FiatCurrencies)) {
+		items = append(items, &lsproto.CompletionItem{
+			Label:  strings.ToLower(code),
+			Kind:   utils.PointerTo(lsproto.CompletionItemKindUnit),
+			Detail: utils.PointerTo(fmt.Sprintf("%s (currency)", code)),
+		})
+	}
+
+	return items
+}
+
+func builtinCompletions() []*lsproto.CompletionItem {
+	items := []*lsproto.CompletionItem{}
+	for _, name := range slices.Sorted(maps.Keys(evaluator.Builtins)) {
+		items = append(items, &lsproto.CompletionItem{
+			Label:  name,
+			Kind:   utils.PointerTo(lsproto.CompletionItemKindFunction),
+			Detail: utils.PointerTo("builtin function"),
+		})
+	}
+	return items
+}
+
+// Returns the last assignment of each variable on the pipe lines above lineIndex.
+func assignedAbove(doc *document, lineIndex int) map[string]*evaluator.Binding {
+	latest := map[string]*evaluator.Binding{}
+	for _, interpretation := range doc.interpretations {
+		if interpretation.LineIndex >= lineIndex {
+			break
+		}
+		for _, binding := range interpretation.Bindings {
+			if binding.Assigned {
+				latest[binding.Name] = binding
+			}
+		}
+	}
+	return latest
+}
+
+// Variables assigned on pipe lines above lineIndex, with the value they held last.
+func variableCompletions(doc *document, lineIndex int) []*lsproto.CompletionItem {
+	latest := assignedAbove(doc, lineIndex)
+	items := []*lsproto.CompletionItem{}
+	for _, name := range slices.Sorted(maps.Keys(latest)) {
+		item := &lsproto.CompletionItem{
+			Label: name,
+			Kind:  utils.PointerTo(lsproto.CompletionItemKindVariable),
+		}
+		if value := latest[name].Value; value != nil {
+			item.Detail = utils.PointerTo(value.Inspect())
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"strings"
+	"testing"
+)
+
+func TestExpectsUnit(t *testing.T) {
+	cases := map[string]bool{
+		" 2 in ":      true,
+		" 2 in k":     true,
+		" 20 ":        true,
+		" sqrt(2) ":   true,
+		" 20 k":       true,
+		" 1 + ":       false,
+		" ":           false,
+		" distance ":  false,
+		" distance i": false,
+	}
+	for beforeCursor, expected := range cases {
+		if got := expectsUnit(beforeCursor); got != expected {
+			t.Errorf("%q: expected %v, got %v", beforeCursor, expected, got)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, strings.Join([]string{
+		"// | rent = 1200 usd",
+		"// | total = rent * 2",
+		"// | 3 km in ",
+		"// | to",
+		"// | later = 1",
+		"const x = 1",
+	}, "\n"))
+
+	cases := []struct {
+		name     string
+		position lsproto.Position
+		// Labels and their details that are offered, "" for no detail.
+		expected map[string]string
+		// Labels that are not offered.
+		unexpected []string
+	}{
+		{"units after in", position(2, 13), map[string]string{"m": "meters (length)", "usd": "USD (currency)", "hex": "number format"}, []string{"rent", "sqrt"}},
+		{"variables above", position(3, 7), map[string]string{"rent": "1200 usd", "total": "2400 usd", "sqrt": "builtin function"}, []string{"later", "km"}},
+		{"before the pipe", position(3, 2), nil, []string{"rent", "m"}},
+		{"not a pipe line", position(5, 3), nil, []string{"rent", "m"}},
+	}
+	for _, c := range cases {
+		response, err := e.handleCompletion(t.Context(), &lsproto.CompletionParams{TextDocument: textDocument(), Position: c.position}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		details := map[string]string{}
+		if response.List != nil {
+			for _, item := range response.List.Items {
+				details[item.Label] = ""
+				if item.Detail != nil {
+					details[item.Label] = *item.Detail
+				}
+			}
+		}
+		for label, detail := range c.expected {
+			if got, ok := details[label]; !ok || got != detail {
+				t.Errorf("%s: expected %s with %q, got %q (offered %v)", c.name, label, detail, got, ok)
+			}
+		}
+		for _, label := range c.unexpected {
+			if _, ok := details[label]; ok {
+				t.Errorf("%s: did not expect %s", c.name, label)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+)
+
+// Collects the diagnostics of every pipe line of a document.
+func (d *document) diagnostics() []*lsproto.Diagnostic {
+	return collectDiagnostics(d.interpretations)
+}
+
+func collectDiagnostics(interpretations []*interpreter.Interpretation) []*lsproto.Diagnostic {
+	diagnostics := []*lsproto.Diagnostic{}
+	for _, interpretation := range interpretations {
+		diagnostics = append(diagnostics, interpretation.Diagnostics...)
+	}
+	return diagnostics
+}
+
+// Pushes the diagnostics of a document to the client. An empty list is sent as well
+// so that errors fixed by the last edit are cleared.
+//
+// Clients that pull diagnostics through `textDocument/diagnostic` are not pushed to.
+func (e *Engine) publishDiagnostics(doc *document) error {
+	if e.pullDiagnostics {
+		return nil
+	}
+	notification := lsproto.TextDocumentPublishDiagnosticsInfo.NewNotificationMessage(&lsproto.PublishDiagnosticsParams{
+		Uri:         doc.uri,
+		Version:     &doc.version,
+		Diagnostics: doc.diagnostics(),
+	})
+	return e.send(notification.Message())
+}
+
+// Removes the diagnostics of a closed document from the client.
+func (e *Engine) clearDiagnostics(uri lsproto.DocumentUri) error {
+	if e.pullDiagnostics {
+		return nil
+	}
+	notification := lsproto.TextDocumentPublishDiagnosticsInfo.NewNotificationMessage(&lsproto.PublishDiagnosticsParams{
+		Uri:         uri,
+		Diagnostics: []*lsproto.Diagnostic{},
+	})
+	return e.send(notification.Message())
+}
+
+// Clients pull right after an edit, before the debounced evaluation of the pipeline ran,
+// so the diagnostics are those of the latest text rather than of the last evaluation.
+func (e *Engine) handleDocumentDiagnostic(ctx context.Context, params *lsproto.DocumentDiagnosticParams, _ *lsproto.RequestMessage) (lsproto.DocumentDiagnosticResponse, error) {
+	items := []*lsproto.Diagnostic{}
+	if e.getPipeline(params.TextDocument.Uri) != nil {
+		_, interpretations, err := e.latestInterpretations(ctx, params.TextDocument.Uri)
+		if err != nil {
+			return lsproto.DocumentDiagnosticResponse{}, err
+		}
+		items = collectDiagnostics(interpretations)
+	}
+	return lsproto.DocumentDiagnosticResponse{
+		FullDocumentDiagnosticReport: &lsproto.RelatedFullDocumentDiagnosticReport{
+			Items: items,
+		},
+	}, nil
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"testing"
+)
+
+func TestPulledDiagnosticsFollowTheLatestChange(t *testing.T) {
+	e := newTestEngine(t)
+	e.pullDiagnostics = true
+	// Edits are not evaluated by the pipeline before the pull.
+	e.settings.EvaluationDebounce = 60_000
+
+	err := e.handleTextDocumentDidOpen(t.Context(), &lsproto.DidOpenTextDocumentParams{
+		TextDocument: &lsproto.TextDocumentItem{Uri: testUri, LanguageId: "markdown", Version: 1, Text: "// | 1 + 2\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		text     string
+		expected int
+	}{
+		{"// | 1 +\n// | foo\n", 2},
+		{"// | 1 + 2\n// | foo\n", 1},
+		{"// | 1 + 2\n", 0},
+	}
+	for i, c := range cases {
+		err := e.handleTextDocumentDidChange(t.Context(), &lsproto.DidChangeTextDocumentParams{
+			TextDocument: lsproto.VersionedTextDocumentIdentifier{Uri: testUri, Version: int32(i + 2)},
+			ContentChanges: []lsproto.TextDocumentContentChangePartialOrWholeDocument{
+				{WholeDocument: &lsproto.TextDocumentContentChangeWholeDocument{Text: c.text}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := e.handleDocumentDiagnostic(t.Context(), &lsproto.DocumentDiagnosticParams{TextDocument: textDocument()}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if items := response.FullDocumentDiagnosticReport.Items; len(items) != c.expected {
+			t.Errorf("%q: expected %d diagnostics, got %d", c.text, c.expected, len(items))
+		}
+	}
+
+	response, err := e.handleDocumentDiagnostic(t.Context(), &lsproto.DocumentDiagnosticParams{
+		TextDocument: lsproto.TextDocumentIdentifier{Uri: "file:///closed.md"},
+	}, nil)
+	if err != nil || len(response.FullDocumentDiagnosticReport.Items) != 0 {
+		t.Errorf("expected no diagnostics for a document that is not open, got %v, %v", response, err)
+	}
+}
+
+func TestWrittenResultIsPartOfTheExpression(t *testing.T) {
+	e := newTestEngine(t)
+	// Results written by `puter eval --write` are for readers without an editor, the
+	// editor evaluates the line as it is, like it did before there were written results.
+	doc := openTestDocument(e, "// | 1 + 2  => 3")
+	interpretation := doc.interpretations[0]
+	diagnostics := doc.diagnostics()
+	if interpretation.Text != " 1 + 2  => 3" || len(diagnostics) != 1 {
+		t.Fatalf("expected the whole line to be evaluated, got %q with %d diagnostics", interpretation.Text, len(diagnostics))
+	}
+	if diagnostics[0].Range != (lsproto.Range{Start: position(0, 13), End: position(0, 14)}) {
+		t.Errorf("expected the diagnostic at the arrow, got %v", diagnostics[0].Range)
+	}
+}
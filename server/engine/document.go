@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+)
+
+// Latest known state of an open document, kept so that requests like hover
+// can be answered without re-interpreting the text.
+type document struct {
+	uri             lsproto.DocumentUri
+	version         int32
+	text            string
+	interpretations []*interpreter.Interpretation
+}
+
+// Returns the interpretation of the pipe line at lineIndex, or nil if the line is not a pipe line.
+func (d *document) interpretationAt(lineIndex int) *interpreter.Interpretation {
+	i, found := slices.BinarySearchFunc(d.interpretations, lineIndex, func(in *interpreter.Interpretation, target int) int {
+		return in.LineIndex - target
+	})
+	if !found {
+		return nil
+	}
+	return d.interpretations[i]
+}
+
+func (e *Engine) getDocument(uri lsproto.DocumentUri) *document {
+	return e.documents.get(uri)
+}
+
+// Returns the text of the line at lineIndex, without the line break.
+func (d *document) line(lineIndex int) string {
+	lines := strings.Split(d.text, "\n")
+	if lineIndex < 0 || lineIndex >= len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[lineIndex], "\r")
+}
+
+// Returns the line break the document uses, so that inserted lines match the rest of it.
+func (d *document) lineBreak() string {
+	if strings.Contains(d.text, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
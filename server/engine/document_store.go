@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Open documents keyed by URI. A document is added on `didOpen`, replaced on every
+// `didChange` and dropped on `didClose`.
+//
+// Stored documents are never modified, a change always stores a new document, so
+// handlers running concurrently can keep reading the one they got.
+type documentStore struct {
+	mu        sync.RWMutex
+	documents map[lsproto.DocumentUri]*document
+}
+
+func newDocumentStore() *documentStore {
+	return &documentStore{
+		documents: make(map[lsproto.DocumentUri]*document),
+	}
+}
+
+// Returns the document for uri, nil if it is not open.
+func (s *documentStore) get(uri lsproto.DocumentUri) *document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.documents[uri]
+}
+
+func (s *documentStore) set(doc *document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[doc.uri] = doc
+}
+
+// Returns every open document, ordered by URI.
+func (s *documentStore) all() []*document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.SortedFunc(maps.Values(s.documents), func(a, b *document) int {
+		return strings.Compare(string(a.uri), string(b.uri))
+	})
+}
+
+// Forgets the document for uri. Returns false if it was not open.
+func (s *documentStore) close(uri lsproto.DocumentUri) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.documents[uri]; !ok {
+		return false
+	}
+	delete(s.documents, uri)
+	return true
+}
+
+// Applies the content changes of a `didChange` notification to text, in the order
+// they were sent. Each change is relative to the text left by the previous one.
+func applyContentChanges(text string, changes []lsproto.TextDocumentContentChangePartialOrWholeDocument) (string, error) {
+	for i, change := range changes {
+		switch {
+		case change.WholeDocument != nil:
+			text = change.WholeDocument.Text
+		case change.Partial != nil:
+			start := offsetAt(text, change.Partial.Range.Start)
+			end := offsetAt(text, change.Partial.Range.End)
+			if start > end {
+				return "", fmt.Errorf("content change %d has its start after its end", i)
+			}
+			text = text[:start] + change.Partial.Text + text[end:]
+		default:
+			return "", fmt.Errorf("content change %d is empty", i)
+		}
+	}
+	return text, nil
+}
+
+// Converts a position to a byte offset into text.
+//
+// Characters are counted in UTF-16 code units, which is what clients send unless
+// another position encoding was negotiated. Positions past the end of a line resolve
+// to the end of that line, positions past the last line to the end of the text.
+func offsetAt(text string, position lsproto.Position) int {
+	offset := 0
+	for line := uint32(0); line < position.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+
+	lineEnd := len(text)
+	if next := strings.IndexByte(text[offset:], '\n'); next >= 0 {
+		lineEnd = offset + next
+	}
+	lineEnd = offset + len(strings.TrimSuffix(text[offset:lineEnd], "\r"))
+
+	for units := uint32(0); units < position.Character && offset < lineEnd; {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += uint32(utf16.RuneLen(r))
+		offset += size
+	}
+	return offset
+}
@@ -9,8 +9,10 @@ import (
 	"puter/interpreter"
 	"puter/logging"
 	lsproto "puter/lsp"
+	"puter/unit"
 	"puter/utils"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -39,19 +41,51 @@ type Engine struct {
 	pendingServerRequestsMu sync.Mutex
 	pendingClientRequests   map[lsproto.ID]pendingClientRequest
 	pendingClientRequestsMu sync.Mutex
-	logger                  logging.Logger
-	initComplete            bool
-	interpreter             *interpreter.Interpreter
+	// Forwards to the client as well, see clientLog.
+	logger logging.Logger
+	// The most detailed level of the log sent to the client as `window/logMessage`.
+	clientLogLevel logging.Level
+	// The lsproto.TraceValue of the client, set by `initialize` and `$/setTrace`.
+	trace              atomic.Value
+	initComplete       bool
+	interpreter        *interpreter.Interpreter
+	clientCapabilities lsproto.ResolvedClientCapabilities
+	// Whether the client pulls diagnostics with `textDocument/diagnostic` instead of
+	// having them pushed with `textDocument/publishDiagnostics`.
+	pullDiagnostics bool
+	// Whether the client renders results as inlay hints, otherwise they are sent
+	// through the custom/evaluationReport notification.
+	inlayHints       bool
+	serverRequestSeq atomic.Int32
+	documents        *documentStore
+	// Evaluation pipeline of each open document, documents only holds finished evaluations.
+	pipelines     map[lsproto.DocumentUri]*pipeline
+	pipelinesMu   sync.Mutex
+	exchangeRates *unit.ExchangeRates
+	// Whether the last fetch of exchange rates failed, the user was told already.
+	ratesUnreachable atomic.Bool
+	progressSeq      atomic.Int32
+	settings         Settings
+	settingsMu       sync.Mutex
+	// Set once `shutdown` was received, every request but `exit` is rejected afterwards.
+	shutdownRequested atomic.Bool
+	// Closed when Run returns, so that nothing waits on the loops anymore.
+	done     chan struct{}
+	exitCode int
 }
 
+// Returned by the `exit` handler to stop the engine.
+var errExit = errors.New("exit requested")
+
 func NewEngine(
 	ctx context.Context,
 	reader Reader,
 	writer Writer,
 	logger logging.Logger,
 	interpreter *interpreter.Interpreter,
+	exchangeRates *unit.ExchangeRates,
 ) *Engine {
-	return &Engine{
+	e := &Engine{
 		ctx:                   ctx,
 		reader:                reader,
 		writer:                writer,
@@ -62,12 +96,22 @@ func NewEngine(
 		interpreter:           interpreter,
 		pendingServerRequests: make(map[lsproto.ID]chan *lsproto.ResponseMessage),
 		pendingClientRequests: make(map[lsproto.ID]pendingClientRequest),
+		documents:             newDocumentStore(),
+		pipelines:             make(map[lsproto.DocumentUri]*pipeline),
+		exchangeRates:         exchangeRates,
+		settings:              defaultSettings(),
+		done:                  make(chan struct{}),
+		clientLogLevel:        logging.LevelWarn,
 	}
+	e.logger = logger.WithForwarder(clientLog{e})
+	exchangeRates.Observe(e.observeFetch)
+	return e
 }
 
+// Serves the client until it exits or the input ends. Messages that were queued by then
+// are still written out. See ExitCode for how the process should exit afterwards.
 func (e *Engine) Run(ctx context.Context) error {
-	defer close(e.outgoingQueue)
-	defer close(e.requestQueue)
+	defer close(e.done)
 
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -91,11 +135,38 @@ func (e *Engine) Run(ctx context.Context) error {
 	// handles incoming request
 	g.Go(func() error { return e.dispatchLoop(ctx) })
 
-	if err := g.Wait(); err != nil && !errors.Is(err, io.EOF) && ctx.Err() != nil {
-		return err
+	err := g.Wait()
+	e.stop()
+	// The spec asks for 1 whenever the server goes away without a `shutdown` first.
+	if !e.shutdownRequested.Load() {
+		e.exitCode = 1
+	}
+	if errors.Is(err, errExit) || errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
+		return nil
 	}
+	e.exitCode = 1
+	return err
+}
 
-	return nil
+// Sets the most detailed level of the log sent to the client as `window/logMessage`.
+// Only warnings and errors are by default, the rest is noise in the output of the client
+// unless asked for. Call it before Run.
+func (e *Engine) SetClientLogLevel(level logging.Level) {
+	e.clientLogLevel = level
+}
+
+// Exit code for the process once Run returned: 0 after an orderly `shutdown` and `exit`,
+// 1 otherwise.
+func (e *Engine) ExitCode() int {
+	return e.exitCode
+}
+
+// Cancels every evaluation and exchange rate request in flight.
+func (e *Engine) stop() {
+	for _, p := range e.allPipelines() {
+		p.stop()
+	}
+	e.exchangeRates.Close()
 }
 
 func (e *Engine) readLoop(ctx context.Context) error {
@@ -104,20 +175,17 @@ func (e *Engine) readLoop(ctx context.Context) error {
 			return err
 		}
 		data, err := e.reader.Read()
+		if err != nil {
+			// Includes io.EOF, the client closed the connection.
+			return err
+		}
 		msg := &lsproto.Message{}
 		if err := json.Unmarshal(data, msg); err != nil {
-			return fmt.Errorf("%w: %w", lsproto.ErrorCodeInvalidRequest, err)
+			e.sendError(nil, fmt.Errorf("%w: %w", lsproto.ErrorCodeParseError, err))
+			continue
 		}
 
-		e.logger.Info("read %+v", msg)
-
-		if err != nil {
-			if errors.Is(err, lsproto.ErrorCodeInvalidRequest) {
-				e.sendError(nil, err)
-				continue
-			}
-			return err
-		}
+		e.logger.Logf("read %s", data)
 
 		if !e.initComplete && msg.Kind == lsproto.MessageKindRequest {
 			req := msg.AsRequest()
@@ -127,6 +195,9 @@ func (e *Engine) readLoop(ctx context.Context) error {
 					return err
 				}
 				e.sendResult(req.ID, resp)
+				// Requests are allowed as soon as the response is out, the `initialized`
+				// notification may still be queued when the next one is read.
+				e.initComplete = true
 			} else {
 				e.sendError(req.ID, lsproto.ErrorCodeServerNotInitialized)
 			}
@@ -135,6 +206,10 @@ func (e *Engine) readLoop(ctx context.Context) error {
 
 		if msg.Kind == lsproto.MessageKindResponse {
 			resp := msg.AsResponse()
+			if resp.ID == nil {
+				e.logger.Warn("response without an id: ", resp.Error)
+				continue
+			}
 			e.pendingServerRequestsMu.Lock()
 			if respChan, ok := e.pendingServerRequests[*resp.ID]; ok {
 				respChan <- resp
@@ -147,7 +222,11 @@ func (e *Engine) readLoop(ctx context.Context) error {
 			if req.Method == lsproto.MethodCancelRequest {
 				e.cancelRequest(req.Params.(*lsproto.CancelParams).Id)
 			} else {
-				e.requestQueue <- req
+				select {
+				case e.requestQueue <- req:
+				case <-e.done:
+					return nil
+				}
 			}
 		}
 	}
@@ -167,29 +246,51 @@ func (e *Engine) writeLoop(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case data := <-e.outgoingQueue:
-			bytes, err := json.Marshal(data)
-			if err != nil {
-				return fmt.Errorf("%w: %w", lsproto.ErrorCodeInvalidRequest, err)
+			// Whatever is queued already, like the response to `shutdown`, still goes out.
+			for {
+				select {
+				case data := <-e.outgoingQueue:
+					if err := e.write(data); err != nil {
+						return err
+					}
+				default:
+					return ctx.Err()
+				}
 			}
-			if err := e.writer.Write(bytes); err != nil {
-				return fmt.Errorf("failed to write message: %w", err)
+		case data := <-e.outgoingQueue:
+			if err := e.write(data); err != nil {
+				return err
 			}
 		}
 	}
 }
 
+func (e *Engine) write(data *lsproto.Message) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		// Only this message is lost, like a report with a result JSON can't represent.
+		e.logger.Error("could not encode message: ", err)
+		return nil
+	}
+	if err := e.writer.Write(bytes); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
 func (e *Engine) dispatchLoop(ctx context.Context) error {
-	ctx, lspExit := context.WithCancel(ctx)
-	defer lspExit()
+	ctx, lspExit := context.WithCancelCause(ctx)
+	defer lspExit(nil)
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return context.Cause(ctx)
 		case req := <-e.requestQueue:
+			// Only requests can be cancelled, notifications run with the context of the
+			// loop, which anything they start in the background can outlive the handler with.
+			reqCtx, cancel := ctx, context.CancelFunc(func() {})
 			if req.ID != nil {
-				var cancel context.CancelFunc
+				reqCtx, cancel = context.WithCancel(ctx)
 				e.pendingClientRequestsMu.Lock()
 				e.pendingClientRequests[*req.ID] = pendingClientRequest{
 					req:    req,
@@ -199,11 +300,12 @@ func (e *Engine) dispatchLoop(ctx context.Context) error {
 			}
 
 			handle := func() {
-				if err := e.handleRequestOrNotification(ctx, req); err != nil {
+				defer cancel()
+				if err := e.handleRequestOrNotification(reqCtx, req); err != nil {
 					if errors.Is(err, context.Canceled) {
 						e.sendError(req.ID, lsproto.ErrorCodeRequestCancelled)
-					} else if errors.Is(err, io.EOF) {
-						lspExit()
+					} else if errors.Is(err, errExit) {
+						lspExit(err)
 					} else {
 						e.sendError(req.ID, err)
 					}
@@ -226,10 +328,17 @@ func (e *Engine) dispatchLoop(ctx context.Context) error {
 }
 
 func (e *Engine) handleRequestOrNotification(ctx context.Context, req *lsproto.RequestMessage) error {
+	if e.shutdownRequested.Load() && req.Method != lsproto.MethodExit {
+		if req.ID != nil {
+			e.sendError(req.ID, fmt.Errorf("%w: server is shutting down", lsproto.ErrorCodeInvalidRequest))
+		}
+		return nil
+	}
 	if handler := handlers()[req.Method]; handler != nil {
+		ctx = lsproto.WithClientCapabilities(ctx, &e.clientCapabilities)
 		start := time.Now()
 		err := handler(e, ctx, req)
-		e.logger.Info("handled method '", req.Method, "' in ", time.Since(start))
+		e.logger.Log("handled method '", req.Method, "' in ", time.Since(start))
 		return err
 	}
 	e.logger.Warn("unknown method '", req.Method, "'")
@@ -246,8 +355,34 @@ var handlers = sync.OnceValue(func() handlerMap {
 
 	registerRequestHandler(handlers, lsproto.InitializeInfo, (*Engine).handleInitialize)
 	registerNotificationHandler(handlers, lsproto.InitializedInfo, (*Engine).handleInitialized)
+	registerRequestHandler(handlers, lsproto.ShutdownInfo, (*Engine).handleShutdown)
+	registerNotificationHandler(handlers, lsproto.ExitInfo, (*Engine).handleExit)
+	registerNotificationHandler(handlers, lsproto.SetTraceInfo, (*Engine).handleSetTrace)
 
+	registerNotificationHandler(handlers, lsproto.WorkspaceDidChangeConfigurationInfo, (*Engine).handleDidChangeConfiguration)
+
+	registerNotificationHandler(handlers, lsproto.TextDocumentDidOpenInfo, (*Engine).handleTextDocumentDidOpen)
 	registerNotificationHandler(handlers, lsproto.TextDocumentDidChangeInfo, (*Engine).handleTextDocumentDidChange)
+	registerNotificationHandler(handlers, lsproto.TextDocumentDidCloseInfo, (*Engine).handleTextDocumentDidClose)
+
+	registerRequestHandler(handlers, lsproto.TextDocumentHoverInfo, (*Engine).handleHover)
+	registerRequestHandler(handlers, lsproto.TextDocumentCompletionInfo, (*Engine).handleCompletion)
+	registerRequestHandler(handlers, lsproto.TextDocumentSignatureHelpInfo, (*Engine).handleSignatureHelp)
+	registerRequestHandler(handlers, lsproto.TextDocumentDefinitionInfo, (*Engine).handleDefinition)
+	registerRequestHandler(handlers, lsproto.TextDocumentReferencesInfo, (*Engine).handleReferences)
+	registerRequestHandler(handlers, lsproto.TextDocumentPrepareRenameInfo, (*Engine).handlePrepareRename)
+	registerRequestHandler(handlers, lsproto.TextDocumentRenameInfo, (*Engine).handleRename)
+	registerRequestHandler(handlers, lsproto.TextDocumentDiagnosticInfo, (*Engine).handleDocumentDiagnostic)
+	registerRequestHandler(handlers, lsproto.TextDocumentInlayHintInfo, (*Engine).handleInlayHint)
+	registerRequestHandler(handlers, lsproto.TextDocumentCodeActionInfo, (*Engine).handleCodeAction)
+	registerRequestHandler(handlers, lsproto.WorkspaceExecuteCommandInfo, (*Engine).handleExecuteCommand)
+	registerRequestHandler(handlers, lsproto.TextDocumentSemanticTokensFullInfo, (*Engine).handleSemanticTokensFull)
+	registerRequestHandler(handlers, lsproto.TextDocumentSemanticTokensRangeInfo, (*Engine).handleSemanticTokensRange)
+	registerRequestHandler(handlers, lsproto.TextDocumentFoldingRangeInfo, (*Engine).handleFoldingRange)
+	registerRequestHandler(handlers, lsproto.TextDocumentDocumentSymbolInfo, (*Engine).handleDocumentSymbol)
+	registerRequestHandler(handlers, lsproto.WorkspaceSymbolInfo, (*Engine).handleWorkspaceSymbol)
+
+	registerRequestHandler(handlers, puterEvaluateInfo, (*Engine).handlePuterEvaluate)
 
 	return handlers
 })
@@ -292,6 +427,9 @@ func isBlockingMethod(method lsproto.Method) bool {
 	switch method {
 	case lsproto.MethodInitialize,
 		lsproto.MethodInitialized,
+		lsproto.MethodShutdown,
+		lsproto.MethodExit,
+		lsproto.MethodSetTrace,
 		lsproto.MethodTextDocumentDidOpen,
 		lsproto.MethodTextDocumentDidChange,
 		lsproto.MethodTextDocumentDidSave,
@@ -325,16 +463,76 @@ func (e *Engine) sendResult(id *lsproto.ID, result any) error {
 	}).Message())
 }
 
+func (e *Engine) nextServerRequestID() *lsproto.ID {
+	id := e.serverRequestSeq.Add(1)
+	return lsproto.NewID(lsproto.IntegerOrString{Integer: &id})
+}
+
 func (e *Engine) send(resp *lsproto.Message) error {
 	select {
 	case e.outgoingQueue <- resp:
 		return nil
+	case <-e.done:
+		return io.ErrClosedPipe
 	case <-e.ctx.Done():
 		return e.ctx.Err()
 	}
 }
 
+// Queues msg unless the queue is full, for messages that are better dropped than waited
+// on. Logs are, the write loop that drains the queue logs as well.
+func (e *Engine) trySend(msg *lsproto.Message) {
+	select {
+	case e.outgoingQueue <- msg:
+	default:
+	}
+}
+
+// Sends a request to the client and waits for its response. The request is abandoned,
+// but not cancelled on the client, when ctx is done first.
+func sendClientRequest[Params, Resp any](ctx context.Context, e *Engine, info lsproto.RequestInfo[Params, Resp], params Params) (Resp, error) {
+	var zero Resp
+	req := info.NewRequestMessage(e.nextServerRequestID(), params)
+	respChan := make(chan *lsproto.ResponseMessage, 1)
+	e.pendingServerRequestsMu.Lock()
+	e.pendingServerRequests[*req.ID] = respChan
+	e.pendingServerRequestsMu.Unlock()
+
+	forget := func() {
+		e.pendingServerRequestsMu.Lock()
+		delete(e.pendingServerRequests, *req.ID)
+		e.pendingServerRequestsMu.Unlock()
+	}
+
+	if err := e.send(req.Message()); err != nil {
+		forget()
+		return zero, err
+	}
+
+	select {
+	case <-ctx.Done():
+		forget()
+		return zero, ctx.Err()
+	case resp := <-respChan:
+		if resp.Error != nil {
+			return zero, fmt.Errorf("%s failed: %s", info.Method, resp.Error.Message)
+		}
+		return info.UnmarshalResult(resp.Result)
+	}
+}
+
 func (e *Engine) handleInitialize(ctx context.Context, params *lsproto.InitializeParams, _ *lsproto.RequestMessage) (lsproto.InitializeResponse, error) {
+	e.clientCapabilities = lsproto.ResolveClientCapabilities(params.Capabilities)
+	if params.Trace != nil {
+		e.trace.Store(*params.Trace)
+	}
+	e.pullDiagnostics = params.Capabilities != nil &&
+		params.Capabilities.TextDocument != nil &&
+		params.Capabilities.TextDocument.Diagnostic != nil
+	e.inlayHints = params.Capabilities != nil &&
+		params.Capabilities.TextDocument != nil &&
+		params.Capabilities.TextDocument.InlayHint != nil
+
 	response := &lsproto.InitializeResult{
 		ServerInfo: &lsproto.ServerInfo{
 			Name:    "puter",
@@ -344,54 +542,159 @@ func (e *Engine) handleInitialize(ctx context.Context, params *lsproto.Initializ
 			TextDocumentSync: &lsproto.TextDocumentSyncOptionsOrKind{
 				Options: &lsproto.TextDocumentSyncOptions{
 					OpenClose: utils.PointerTo(true),
-					Change:    utils.PointerTo(lsproto.TextDocumentSyncKindFull),
+					Change:    utils.PointerTo(lsproto.TextDocumentSyncKindIncremental),
 					Save: &lsproto.BooleanOrSaveOptions{
 						Boolean: utils.PointerTo(true),
 					},
 				},
 			},
-			// HoverProvider: &lsproto.BooleanOrHoverOptions{
-			// 	Boolean: utils.PointerTo(true),
-			// },
-			// DefinitionProvider: &lsproto.BooleanOrDefinitionOptions{
-			// 	Boolean: utils.PointerTo(true),
-			// },
+			HoverProvider: &lsproto.BooleanOrHoverOptions{
+				Boolean: utils.PointerTo(true),
+			},
+			CompletionProvider: &lsproto.CompletionOptions{
+				TriggerCharacters: &[]string{" "},
+			},
+			SignatureHelpProvider: &lsproto.SignatureHelpOptions{
+				TriggerCharacters:   &[]string{"(", ","},
+				RetriggerCharacters: &[]string{")"},
+			},
+			DefinitionProvider: &lsproto.BooleanOrDefinitionOptions{
+				Boolean: utils.PointerTo(true),
+			},
 			// TypeDefinitionProvider: &lsproto.BooleanOrTypeDefinitionOptionsOrTypeDefinitionRegistrationOptions{
 			// 	Boolean: utils.PointerTo(true),
 			// },
-			// ReferencesProvider: &lsproto.BooleanOrReferenceOptions{
-			// 	Boolean: utils.PointerTo(true),
-			// },
-			// DiagnosticProvider: &lsproto.DiagnosticOptionsOrRegistrationOptions{
-			// 	Options: &lsproto.DiagnosticOptions{
-			// 		InterFileDependencies: true,
-			// 	},
-			// },
-			// RenameProvider: &lsproto.BooleanOrRenameOptions{
-			// 	Boolean: utils.PointerTo(true),
-			// },
+			ReferencesProvider: &lsproto.BooleanOrReferenceOptions{
+				Boolean: utils.PointerTo(true),
+			},
+			RenameProvider: &lsproto.BooleanOrRenameOptions{
+				RenameOptions: &lsproto.RenameOptions{
+					PrepareProvider: utils.PointerTo(true),
+				},
+			},
+			CodeActionProvider: &lsproto.BooleanOrCodeActionOptions{
+				CodeActionOptions: &lsproto.CodeActionOptions{
+					CodeActionKinds: &[]lsproto.CodeActionKind{
+						lsproto.CodeActionKindQuickFix,
+						lsproto.CodeActionKindRefactor,
+						lsproto.CodeActionKindRefactorInline,
+						lsproto.CodeActionKindRefactorRewrite,
+						evaluateSelectionKind,
+					},
+				},
+			},
+			ExecuteCommandProvider: &lsproto.ExecuteCommandOptions{
+				Commands: commandNames(),
+			},
+			FoldingRangeProvider: &lsproto.BooleanOrFoldingRangeOptionsOrFoldingRangeRegistrationOptions{
+				Boolean: utils.PointerTo(true),
+			},
+			DocumentSymbolProvider: &lsproto.BooleanOrDocumentSymbolOptions{
+				Boolean: utils.PointerTo(true),
+			},
+			WorkspaceSymbolProvider: &lsproto.BooleanOrWorkspaceSymbolOptions{
+				Boolean: utils.PointerTo(true),
+			},
+			SemanticTokensProvider: &lsproto.SemanticTokensOptionsOrRegistrationOptions{
+				Options: &lsproto.SemanticTokensOptions{
+					Legend: semanticTokensLegend(),
+					Range: &lsproto.BooleanOrEmptyObject{
+						Boolean: utils.PointerTo(true),
+					},
+					Full: &lsproto.BooleanOrSemanticTokensFullDelta{
+						Boolean: utils.PointerTo(true),
+					},
+				},
+			},
 		},
 	}
 
+	if e.inlayHints {
+		response.Capabilities.InlayHintProvider = &lsproto.BooleanOrInlayHintOptionsOrInlayHintRegistrationOptions{
+			Boolean: utils.PointerTo(true),
+		}
+	}
+	if e.pullDiagnostics {
+		response.Capabilities.DiagnosticProvider = &lsproto.DiagnosticOptionsOrRegistrationOptions{
+			Options: &lsproto.DiagnosticOptions{
+				Identifier: utils.PointerTo("puter"),
+				// Pipe lines only ever see variables from their own document.
+				InterFileDependencies: false,
+				WorkspaceDiagnostics:  false,
+			},
+		}
+	}
+
 	return response, nil
 }
 
 func (e *Engine) handleInitialized(ctx context.Context, params *lsproto.InitializedParams) error {
-	e.initComplete = true
+	// Pulled before anything else is handled so that documents opened right after
+	// are evaluated with the right settings the first time.
+	return e.pullSettings(ctx)
+}
+
+// Stops evaluating and fetching rates, the client only sends `exit` afterwards.
+func (e *Engine) handleShutdown(ctx context.Context, params any, _ *lsproto.RequestMessage) (lsproto.ShutdownResponse, error) {
+	e.shutdownRequested.Store(true)
+	e.stop()
+	return lsproto.ShutdownResponse{}, nil
+}
+
+func (e *Engine) handleExit(ctx context.Context, params any) error {
+	return errExit
+}
+
+// Evaluation happens in the pipeline of the document, the handlers only hand it the
+// latest text. Opened documents are evaluated right away, edits once typing pauses.
+func (e *Engine) handleTextDocumentDidOpen(ctx context.Context, params *lsproto.DidOpenTextDocumentParams) error {
+	item := params.TextDocument
+	p := e.openPipeline(item.Uri, string(item.LanguageId), item.Version, item.Text)
+	e.scheduleEvaluation(ctx, p, 0)
 	return nil
 }
 
 func (e *Engine) handleTextDocumentDidChange(ctx context.Context, params *lsproto.DidChangeTextDocumentParams) error {
+	uri := params.TextDocument.Uri
+	p := e.getPipeline(uri)
+	if p == nil {
+		e.logger.Warn("change to document '", uri, "' that is not open")
+		return nil
+	}
 
-	for _, change := range params.ContentChanges {
-		interpretations := e.interpreter.Interpret(
-			change.WholeDocument.Text,
-		)
-		response := &lsproto.RequestMessage{
-			Method: "custom/evaluationReport",
-			Params: map[string]any{"interpretations": interpretations, "uri": params.TextDocument.Uri},
-		}
-		e.send(response.Message())
+	p.mu.Lock()
+	text, err := applyContentChanges(p.text, params.ContentChanges)
+	if err == nil {
+		p.text = text
+		p.version = params.TextDocument.Version
 	}
+	p.mu.Unlock()
+	if err != nil {
+		e.logger.Error("could not apply changes to '", uri, "': ", err)
+		return nil
+	}
+	e.scheduleEvaluation(ctx, p, e.evaluationDebounce())
 	return nil
 }
+
+func (e *Engine) handleTextDocumentDidClose(ctx context.Context, params *lsproto.DidCloseTextDocumentParams) error {
+	uri := params.TextDocument.Uri
+	// The pipeline goes first so that no evaluation in flight stores the document again.
+	p := e.closePipeline(uri)
+	if p == nil {
+		return nil
+	}
+	// Results that are being reported go out before they are cleared.
+	p.reportMu.Lock()
+	defer p.reportMu.Unlock()
+	e.documents.close(uri)
+	return e.clearDiagnostics(uri)
+}
+
+// Reports doc, the latest state of its document, to the client.
+func (e *Engine) reportDocument(ctx context.Context, previous *document, doc *document) error {
+	if err := e.publishDiagnostics(doc); err != nil {
+		return err
+	}
+	return e.reportResults(ctx, previous, doc)
+}
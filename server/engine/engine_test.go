@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"io"
+	"puter/interpreter"
+	"puter/logging"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"testing"
+	"time"
+
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+const testUri lsproto.DocumentUri = "file:///notes.md"
+
+// Returns an engine that is not running, handlers are called on it directly and what it
+// sends stays in its outgoing queue.
+func newTestEngine(t *testing.T) *Engine {
+	converters := &unit.Converters{
+		ConvertCurrency: func(fromValue float64, fromUnit string, toUnit string) (float64, error) {
+			return fromValue * 2, nil
+		},
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+	exchangeRates := unit.NewExchangeRates()
+	t.Cleanup(exchangeRates.Close)
+	return NewEngine(
+		t.Context(),
+		nil,
+		nil,
+		logging.NewLogger(io.Discard),
+		interpreter.NewInterpreter(t.Context(), converters),
+		exchangeRates,
+	)
+}
+
+// Stores text as the evaluated document of testUri, like its pipeline does once it ran.
+func openTestDocument(e *Engine, text string) *document {
+	doc := &document{
+		uri:             testUri,
+		version:         1,
+		text:            text,
+		interpretations: e.interpreter.Interpret(text),
+	}
+	e.documents.set(doc)
+	return doc
+}
+
+// Takes the messages the engine queued to send so far.
+func sentMessages(e *Engine) []*lsproto.Message {
+	messages := []*lsproto.Message{}
+	for {
+		select {
+		case message := <-e.outgoingQueue:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func position(line uint32, character uint32) lsproto.Position {
+	return lsproto.Position{Line: line, Character: character}
+}
+
+func textDocument() lsproto.TextDocumentIdentifier {
+	return lsproto.TextDocumentIdentifier{Uri: testUri}
+}
+
+// Waits for the next request the engine sends to the client, skipping notifications, and
+// answers it with result, a JSON value.
+func answerClientRequest(t *testing.T, e *Engine, result string) *lsproto.RequestMessage {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-e.outgoingQueue:
+			if message.Kind != lsproto.MessageKindRequest || message.AsRequest().ID == nil {
+				continue
+			}
+			req := message.AsRequest()
+			e.pendingServerRequestsMu.Lock()
+			respChan := e.pendingServerRequests[*req.ID]
+			delete(e.pendingServerRequests, *req.ID)
+			e.pendingServerRequestsMu.Unlock()
+			respChan <- &lsproto.ResponseMessage{ID: req.ID, Result: jsontext.Value(result)}
+			return req
+		case <-timeout:
+			t.Fatal("timed out waiting for a request to the client")
+		}
+	}
+}
+
+// Waits until condition holds, for something the engine does in the background.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", description)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"puter/evaluation/evaluator/box"
+	lsproto "puter/lsp"
+	"puter/utils"
+	"strings"
+)
+
+// Command that evaluates an arbitrary expression, see evaluateArguments.
+const evaluateCommand = "puter.evaluate"
+
+// Command behind the evaluate selection code action. Same as evaluateCommand, except that
+// the result is also shown to the user.
+const evaluateSelectionCommand = "puter.evaluateSelection"
+
+// Kind of the code action that evaluates the selected text.
+const evaluateSelectionKind lsproto.CodeActionKind = "puter.evaluateSelection"
+
+// Argument of evaluateCommand. The document context is optional; with it the expression
+// sees the variables assigned on the pipe lines above line, and diagnostics are positioned
+// as if the text started at line and character of the document. Without it, diagnostics
+// are relative to the text itself.
+type evaluateArguments struct {
+	Text      string               `json:"text"`
+	Uri       *lsproto.DocumentUri `json:"uri,omitzero"`
+	Line      *uint32              `json:"line,omitzero"`
+	Character *uint32              `json:"character,omitzero"`
+}
+
+type evaluateResult struct {
+	// The formatted result, empty when the text could not be evaluated.
+	Result      string                `json:"result"`
+	Diagnostics []*lsproto.Diagnostic `json:"diagnostics"`
+}
+
+func (e *Engine) executeEvaluate(ctx context.Context, arguments []any) (any, error) {
+	args := &evaluateArguments{}
+	if err := decodeArgument(evaluateCommand, arguments, args); err != nil {
+		return nil, err
+	}
+	return e.evaluate(ctx, args)
+}
+
+func (e *Engine) executeEvaluateSelection(ctx context.Context, arguments []any) (any, error) {
+	args := &evaluateArguments{}
+	if err := decodeArgument(evaluateSelectionCommand, arguments, args); err != nil {
+		return nil, err
+	}
+	result, err := e.evaluate(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &lsproto.ShowMessageParams{
+		Type:    lsproto.MessageTypeInfo,
+		Message: fmt.Sprintf("%s = %s", strings.TrimSpace(args.Text), result.Result),
+	}
+	if len(result.Diagnostics) > 0 {
+		message.Type = lsproto.MessageTypeError
+		message.Message = fmt.Sprintf("%s: %s", strings.TrimSpace(args.Text), result.Diagnostics[0].Message)
+	}
+	notification := lsproto.WindowShowMessageInfo.NewNotificationMessage(message)
+	if err := e.send(notification.Message()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *Engine) evaluate(ctx context.Context, args *evaluateArguments) (*evaluateResult, error) {
+	line, character := 0, 0
+	if args.Line != nil {
+		line = int(*args.Line)
+	}
+	if args.Character != nil {
+		character = int(*args.Character)
+	}
+
+	variables := map[string]box.Box{}
+	if args.Uri != nil {
+		doc := e.getDocument(*args.Uri)
+		if doc == nil {
+			return nil, fmt.Errorf("%w: %s is not open", lsproto.ErrorCodeInvalidParams, *args.Uri)
+		}
+		// Without a line, everything assigned in the document is visible.
+		visibleBefore := math.MaxInt
+		if args.Line != nil {
+			visibleBefore = line
+			// The client counts characters in UTF-16 code units, columns of results are
+			// bytes of the line.
+			lineStart := offsetAt(doc.text, lsproto.Position{Line: uint32(line)})
+			character = offsetAt(doc.text, lsproto.Position{Line: uint32(line), Character: uint32(character)}) - lineStart
+		}
+		for name, binding := range assignedAbove(doc, visibleBefore) {
+			if binding.Value != nil {
+				variables[name] = binding.Value
+			}
+		}
+	}
+
+	interpretation := e.interpreter.Evaluate(ctx, args.Text, variables, line, character)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &evaluateResult{
+		Result:      interpretation.EvalResult,
+		Diagnostics: interpretation.Diagnostics,
+	}, nil
+}
+
+// Offers to evaluate the selected text when it is on a single line. Selections inside
+// pipe lines already have a result, they are left alone.
+func evaluateSelectionAction(doc *document, selection lsproto.Range) *lsproto.CodeAction {
+	if selection.Start.Line != selection.End.Line || doc.interpretationAt(int(selection.Start.Line)) != nil {
+		return nil
+	}
+	// A client may send a selection from where it ended to where it started.
+	if lsproto.ComparePositions(selection.Start, selection.End) > 0 {
+		selection.Start, selection.End = selection.End, selection.Start
+	}
+	text := doc.text[offsetAt(doc.text, selection.Start):offsetAt(doc.text, selection.End)]
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	args := &evaluateArguments{
+		Text:      text,
+		Uri:       utils.PointerTo(doc.uri),
+		Line:      utils.PointerTo(selection.Start.Line),
+		Character: utils.PointerTo(selection.Start.Character),
+	}
+	return &lsproto.CodeAction{
+		Title: "Evaluate selection",
+		Kind:  utils.PointerTo(evaluateSelectionKind),
+		Command: &lsproto.Command{
+			Title:     "Evaluate selection",
+			Command:   evaluateSelectionCommand,
+			Arguments: &[]any{args},
+		},
+	}
+}
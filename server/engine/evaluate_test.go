@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	lsproto "puter/lsp"
+	"strings"
+	"testing"
+)
+
+var evaluateText = strings.Join([]string{
+	"// | total = 3 km",
+	"The distance is total in m.",
+	"// | total = 5 km",
+	"Für €: total + x",
+}, "\n")
+
+func executeCommand(t *testing.T, e *Engine, command string, argument any) (*evaluateResult, error) {
+	t.Helper()
+	response, err := e.handleExecuteCommand(t.Context(), &lsproto.ExecuteCommandParams{Command: command, Arguments: &[]any{argument}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return (*response.LSPAny).(*evaluateResult), nil
+}
+
+func TestEvaluateCommand(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, evaluateText)
+	cases := []struct {
+		name     string
+		argument map[string]any
+		result   string
+		// The range of the only diagnostic, nil for none.
+		diagnostic *lsproto.Range
+	}{
+		{"variables above the line", map[string]any{"text": "total * 2", "uri": string(testUri), "line": 1}, "6 kilometers", nil},
+		{"every variable without a line", map[string]any{"text": "total * 2", "uri": string(testUri)}, "10 kilometers", nil},
+		{"no document", map[string]any{"text": "1 + 2"}, "3", nil},
+		{"diagnostic in the document", map[string]any{"text": "total + x", "uri": string(testUri), "line": 1, "character": 16}, "", &lsproto.Range{Start: position(1, 24), End: position(1, 25)}},
+		{"diagnostic in the text", map[string]any{"text": "1 + x"}, "", &lsproto.Range{Start: position(0, 4), End: position(0, 5)}},
+		// The selection starts at 7 UTF-16 code units, 10 bytes into the line.
+		{"diagnostic after non-ASCII text", map[string]any{"text": "total + x", "uri": string(testUri), "line": 3, "character": 7}, "", &lsproto.Range{Start: position(3, 18), End: position(3, 19)}},
+		{"no assertion", map[string]any{"text": "total > 4 km ?", "uri": string(testUri), "line": 1}, "false", nil},
+	}
+	for _, c := range cases {
+		result, err := executeCommand(t, e, evaluateCommand, c.argument)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if result.Result != c.result {
+			t.Errorf("%s: expected %q, got %q", c.name, c.result, result.Result)
+		}
+		if c.diagnostic == nil && len(result.Diagnostics) != 0 || c.diagnostic != nil && (len(result.Diagnostics) != 1 || result.Diagnostics[0].Range != *c.diagnostic) {
+			t.Errorf("%s: expected a diagnostic at %v, got %v", c.name, c.diagnostic, result.Diagnostics)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	arguments := &[]any{map[string]any{"text": "1 + 2"}}
+	if _, err := e.handleExecuteCommand(ctx, &lsproto.ExecuteCommandParams{Command: evaluateCommand, Arguments: arguments}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled evaluation, got %v", err)
+	}
+
+	invalid := []struct {
+		command  string
+		argument any
+	}{
+		{"puter.unknown", map[string]any{"text": "1"}},
+		{evaluateCommand, map[string]any{"text": "1", "uri": "file:///closed.md"}},
+		{evaluateCommand, "1 + 2"},
+	}
+	for _, c := range invalid {
+		if _, err := executeCommand(t, e, c.command, c.argument); !errors.Is(err, lsproto.ErrorCodeInvalidParams) {
+			t.Errorf("%s %v: expected invalid params, got %v", c.command, c.argument, err)
+		}
+	}
+}
+
+func TestEvaluateSelection(t *testing.T) {
+	e := newTestEngine(t)
+	doc := openTestDocument(e, evaluateText)
+
+	selection := lsproto.Range{Start: position(1, 16), End: position(1, 26)}
+	action := evaluateSelectionAction(doc, selection)
+	if action == nil {
+		t.Fatal("expected to evaluate the selection")
+	}
+	args := (*action.Command.Arguments)[0].(*evaluateArguments)
+	if args.Text != "total in m" || *args.Line != 1 || *args.Character != 16 {
+		t.Errorf("expected the selected text at 1:16, got %q at %d:%d", args.Text, *args.Line, *args.Character)
+	}
+
+	result, err := executeCommand(t, e, evaluateSelectionCommand, map[string]any{"text": args.Text, "uri": string(testUri), "line": 1, "character": 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := sentMessages(e)
+	if result.Result != "3000 meters" || len(sent) != 1 {
+		t.Fatalf("expected 3000 meters to be shown, got %q and %d messages", result.Result, len(sent))
+	}
+	if message := sent[0].AsRequest().Params.(*lsproto.ShowMessageParams); message.Message != "total in m = 3000 meters" {
+		t.Errorf("expected the result to be shown, got %q", message.Message)
+	}
+
+	reversed := evaluateSelectionAction(doc, lsproto.Range{Start: position(1, 26), End: position(1, 16)})
+	if reversed == nil {
+		t.Fatal("expected to evaluate a reversed selection")
+	}
+	if args := (*reversed.Command.Arguments)[0].(*evaluateArguments); args.Text != "total in m" || *args.Character != 16 {
+		t.Errorf("expected the reversed selection at 1:16, got %q at 1:%d", args.Text, *args.Character)
+	}
+
+	for _, selection := range []lsproto.Range{
+		{Start: position(0, 5), End: position(0, 10)},
+		{Start: position(1, 0), End: position(2, 3)},
+		{Start: position(1, 3), End: position(1, 4)},
+		{Start: position(1, 3), End: position(1, 3)},
+	} {
+		if action := evaluateSelectionAction(doc, selection); action != nil {
+			t.Errorf("%v: expected nothing to evaluate, got %q", selection, (*action.Command.Arguments)[0].(*evaluateArguments).Text)
+		}
+	}
+}
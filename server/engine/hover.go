@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"puter/evaluation/evaluator"
+	"puter/evaluation/evaluator/box"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+	"strings"
+)
+
+func (e *Engine) handleHover(ctx context.Context, params *lsproto.HoverParams, _ *lsproto.RequestMessage) (lsproto.HoverResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.HoverResponse{}, nil
+	}
+	interpretation := doc.interpretationAt(int(params.Position.Line))
+	if interpretation == nil {
+		return lsproto.HoverResponse{}, nil
+	}
+
+	kind := lsproto.PreferredMarkupKind(lsproto.GetClientCapabilities(ctx).TextDocument.Hover.ContentFormat)
+
+	if binding := bindingAt(interpretation, int(params.Position.Character)); binding != nil {
+		return lsproto.HoverResponse{
+			Hover: &lsproto.Hover{
+				Contents: lsproto.MarkupContentOrStringOrMarkedStringWithLanguageOrMarkedStrings{
+					MarkupContent: &lsproto.MarkupContent{
+						Kind:  kind,
+						Value: describeBinding(binding, interpretation.LineIndex, kind),
+					},
+				},
+				Range: utils.PointerTo(interpretation.BindingRange(binding)),
+			},
+		}, nil
+	}
+
+	return lsproto.HoverResponse{
+		Hover: &lsproto.Hover{
+			Contents: lsproto.MarkupContentOrStringOrMarkedStringWithLanguageOrMarkedStrings{
+				MarkupContent: &lsproto.MarkupContent{
+					Kind:  kind,
+					Value: describeInterpretation(interpretation, kind),
+				},
+			},
+		},
+	}, nil
+}
+
+// Returns the binding under the given character of the line, nil if there is none.
+// The end position is inclusive so that hovering right after a name still resolves it.
+func bindingAt(interpretation *interpreter.Interpretation, character int) *evaluator.Binding {
+	relative := character - interpretation.Column
+	for _, binding := range interpretation.Bindings {
+		if binding.StartPos <= relative && relative <= binding.EndPos {
+			return binding
+		}
+	}
+	return nil
+}
+
+func describeInterpretation(interpretation *interpreter.Interpretation, kind lsproto.MarkupKind) string {
+	h := newHoverBuilder(kind)
+	if interpretation.EvalResult == "" {
+		h.block("no result")
+	} else {
+		h.block(interpretation.EvalResult)
+	}
+	h.describeBox(interpretation.Box)
+
+	if len(interpretation.Conversions) > 0 {
+		h.field("Conversions", "")
+		for i, conversion := range interpretation.Conversions {
+			h.item(i+1, fmt.Sprintf("%s → %s", h.code(conversion.From.Inspect()), h.code(conversion.To.Inspect())))
+		}
+	}
+
+	for _, diagnostic := range interpretation.Diagnostics {
+		h.field("Error", diagnostic.Message)
+	}
+
+	return h.String()
+}
+
+func describeBinding(binding *evaluator.Binding, lineIndex int, kind lsproto.MarkupKind) string {
+	h := newHoverBuilder(kind)
+	if binding.Value == nil {
+		h.block(binding.Name)
+		h.line(fmt.Sprintf("%s has no value at line %d", h.code(binding.Name), lineIndex+1))
+		return h.String()
+	}
+
+	h.block(fmt.Sprintf("%s = %s", binding.Name, binding.Value.Inspect()))
+	h.describeBox(binding.Value)
+	if binding.Assigned {
+		h.line(fmt.Sprintf("Assigned at line %d", lineIndex+1))
+	} else {
+		h.line(fmt.Sprintf("Value as of line %d", lineIndex+1))
+	}
+	return h.String()
+}
+
+// Puts together hover content that reads well as both markdown and plain text.
+type hoverBuilder struct {
+	kind lsproto.MarkupKind
+	sb   strings.Builder
+}
+
+func newHoverBuilder(kind lsproto.MarkupKind) *hoverBuilder {
+	return &hoverBuilder{kind: kind}
+}
+
+func (h *hoverBuilder) isMarkdown() bool {
+	return h.kind == lsproto.MarkupKindMarkdown
+}
+
+func (h *hoverBuilder) code(text string) string {
+	if h.isMarkdown() {
+		return "`" + text + "`"
+	}
+	return text
+}
+
+func (h *hoverBuilder) block(text string) {
+	if h.isMarkdown() {
+		h.sb.WriteString("```puter\n" + text + "\n```\n")
+		return
+	}
+	h.sb.WriteString(text + "\n\n")
+}
+
+func (h *hoverBuilder) line(text string) {
+	h.sb.WriteString(text)
+	if h.isMarkdown() {
+		// Markdown needs a hard break to keep consecutive lines apart.
+		h.sb.WriteString("  ")
+	}
+	h.sb.WriteString("\n")
+}
+
+func (h *hoverBuilder) field(name string, value string) {
+	if h.isMarkdown() {
+		name = "**" + name + ":**"
+	} else {
+		name = name + ":"
+	}
+	if value == "" {
+		h.line(name)
+		return
+	}
+	h.line(name + " " + value)
+}
+
+func (h *hoverBuilder) item(index int, text string) {
+	h.line(fmt.Sprintf("%d. %s", index, text))
+}
+
+func (h *hoverBuilder) describeBox(value box.Box) {
+	if value == nil {
+		return
+	}
+	h.field("Type", h.code(boxTypeName(value)))
+	if name, family := boxUnit(value); name != "" {
+		h.field("Unit", fmt.Sprintf("%s (%s)", h.code(name), family))
+	}
+}
+
+func (h *hoverBuilder) String() string {
+	return strings.TrimRight(h.sb.String(), " \n")
+}
+
+func boxTypeName(value box.Box) string {
+	switch value.(type) {
+	case *box.NumberBox:
+		return "NumberBox"
+	case *box.CurrencyBox:
+		return "CurrencyBox"
+	case *box.FixedUnitBox:
+		return "FixedUnitBox"
+	case *box.PercentBox:
+		return "PercentBox"
+	case *box.BooleanBox:
+		return "BooleanBox"
+	default:
+		return string(value.Type())
+	}
+}
+
+// Returns the unit of a box and the family it belongs to, length, mass, currency, etc.
+// Boxes without a unit return empty strings.
+func boxUnit(value box.Box) (string, string) {
+	switch v := value.(type) {
+	case *box.FixedUnitBox:
+		detail, ok := unit.FixedUnitTypes[v.FixedUnitType]
+		if !ok {
+			return string(v.FixedUnitType), "unknown"
+		}
+		return string(v.FixedUnitType), detail.UnitFor
+	case *box.CurrencyBox:
+		return v.Unit, "currency"
+	case *box.NumberBox:
+		return string(v.NumberType), "number format"
+	default:
+		return "", ""
+	}
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"strings"
+	"testing"
+)
+
+func TestHover(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, strings.Join([]string{
+		"// | distance = 3 km",
+		"// | distance in m",
+		"const x = 1",
+		"// | foo + 1",
+	}, "\n"))
+	markdown := lsproto.WithClientCapabilities(t.Context(), &lsproto.ResolvedClientCapabilities{
+		TextDocument: lsproto.ResolvedTextDocumentClientCapabilities{
+			Hover: lsproto.ResolvedHoverClientCapabilities{ContentFormat: []lsproto.MarkupKind{lsproto.MarkupKindMarkdown}},
+		},
+	})
+
+	cases := []struct {
+		name     string
+		position lsproto.Position
+		// Lines the hover contains, empty when there is no hover.
+		expected []string
+		// The range of the variable under the cursor, nil for the whole line.
+		expectedRange *lsproto.Range
+	}{
+		{"assigned variable", position(0, 7), []string{"distance = 3 kilometers", "**Unit:** `km` (length)", "Assigned at line 1"}, &lsproto.Range{Start: position(0, 5), End: position(0, 13)}},
+		{"end of a variable", position(1, 13), []string{"distance = 3 kilometers", "Value as of line 2"}, &lsproto.Range{Start: position(1, 5), End: position(1, 13)}},
+		{"unit", position(1, 17), []string{"3000 meters", "**Type:** `FixedUnitBox`", "**Unit:** `m` (length)", "**Conversions:**", "1. `3 kilometers` → `3000 meters`"}, nil},
+		{"error", position(3, 11), []string{"no result", "**Error:** Identifier foo not found"}, nil},
+		{"not a pipe line", position(2, 3), nil, nil},
+	}
+	for _, c := range cases {
+		response, err := e.handleHover(markdown, &lsproto.HoverParams{TextDocument: textDocument(), Position: c.position}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.expected == nil {
+			if response.Hover != nil {
+				t.Errorf("%s: expected no hover, got %q", c.name, response.Hover.Contents.MarkupContent.Value)
+			}
+			continue
+		}
+		if response.Hover == nil {
+			t.Errorf("%s: expected a hover", c.name)
+			continue
+		}
+		value := response.Hover.Contents.MarkupContent.Value
+		for _, line := range c.expected {
+			if !strings.Contains(value, line) {
+				t.Errorf("%s: expected %q in\n%s", c.name, line, value)
+			}
+		}
+		if (c.expectedRange == nil) != (response.Hover.Range == nil) || (c.expectedRange != nil && *c.expectedRange != *response.Hover.Range) {
+			t.Errorf("%s: expected range %v, got %v", c.name, c.expectedRange, response.Hover.Range)
+		}
+	}
+}
+
+func TestHoverPlainText(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, "// | 2 usd")
+	response, err := e.handleHover(t.Context(), &lsproto.HoverParams{TextDocument: textDocument(), Position: position(0, 7)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "2 usd\n\nType: CurrencyBox\nUnit: usd (currency)\nConversions:\n1. 2 → 2 usd"
+	if value := response.Hover.Contents.MarkupContent.Value; value != expected {
+		t.Errorf("expected %q, got %q", expected, value)
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"context"
+	lsproto "puter/lsp"
+	"puter/utils"
+	"strings"
+)
+
+// Results are shown at the end of each pipe line as inlay hints.
+func (e *Engine) handleInlayHint(ctx context.Context, params *lsproto.InlayHintParams, _ *lsproto.RequestMessage) (lsproto.InlayHintResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.InlayHintResponse{}, nil
+	}
+
+	lines := strings.Split(doc.text, "\n")
+	hints := []*lsproto.InlayHint{}
+	for _, interpretation := range doc.interpretations {
+		line := uint32(interpretation.LineIndex)
+		if line < params.Range.Start.Line || line > params.Range.End.Line {
+			continue
+		}
+		if interpretation.EvalResult == "" || interpretation.LineIndex >= len(lines) {
+			continue
+		}
+		end := len(strings.TrimRight(lines[interpretation.LineIndex], "\r"))
+		hints = append(hints, &lsproto.InlayHint{
+			Position: lsproto.Position{Line: line, Character: uint32(end)},
+			Label: lsproto.StringOrInlayHintLabelParts{
+				String: utils.PointerTo(interpretation.EvalResult),
+			},
+			PaddingLeft: utils.PointerTo(true),
+		})
+	}
+
+	return lsproto.InlayHintResponse{InlayHints: &hints}, nil
+}
+
+// Lets the client know that the results of a document are ready.
+//
+// Clients that support inlay hints are asked to refresh them when any result changed,
+// everything else gets the custom/evaluationReport notification to render on its own.
+func (e *Engine) reportResults(ctx context.Context, previous *document, doc *document) error {
+	if !e.inlayHints {
+		return e.sendEvaluationReport(doc)
+	}
+	if !lsproto.GetClientCapabilities(ctx).Workspace.InlayHint.RefreshSupport {
+		return nil
+	}
+	if !resultsChanged(previous, doc) {
+		return nil
+	}
+	refresh := lsproto.WorkspaceInlayHintRefreshInfo.NewRequestMessage(e.nextServerRequestID(), nil)
+	return e.send(refresh.Message())
+}
+
+// Params of custom/evaluationReport, only what a client needs to render the results.
+type evaluationReport struct {
+	Uri lsproto.DocumentUri `json:"uri"`
+	// Lets the client drop a report for text it no longer shows.
+	Version         int32           `json:"version"`
+	Interpretations []*reportedLine `json:"interpretations"`
+}
+
+// A pipe line of custom/evaluationReport. The names are those of the fields of
+// interpreter.Interpretation, which clients read since it was sent as it is.
+type reportedLine struct {
+	LineIndex   int                   `json:"LineIndex"`
+	Column      int                   `json:"Column"`
+	Text        string                `json:"Text"`
+	EvalResult  string                `json:"EvalResult"`
+	Diagnostics []*lsproto.Diagnostic `json:"Diagnostics"`
+}
+
+func (e *Engine) sendEvaluationReport(doc *document) error {
+	lines := []*reportedLine{}
+	for _, interpretation := range doc.interpretations {
+		lines = append(lines, &reportedLine{
+			LineIndex:   interpretation.LineIndex,
+			Column:      interpretation.Column,
+			Text:        interpretation.Text,
+			EvalResult:  interpretation.EvalResult,
+			Diagnostics: interpretation.Diagnostics,
+		})
+	}
+	report := &lsproto.RequestMessage{
+		Method: "custom/evaluationReport",
+		Params: &evaluationReport{Uri: doc.uri, Version: doc.version, Interpretations: lines},
+	}
+	return e.send(report.Message())
+}
+
+func resultsChanged(previous *document, doc *document) bool {
+	if previous == nil || len(previous.interpretations) != len(doc.interpretations) {
+		return true
+	}
+	for i, interpretation := range doc.interpretations {
+		before := previous.interpretations[i]
+		if before.LineIndex != interpretation.LineIndex || before.EvalResult != interpretation.EvalResult {
+			return true
+		}
+	}
+	return false
+}
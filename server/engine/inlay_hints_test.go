@@ -0,0 +1,101 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"testing"
+
+	"github.com/go-json-experiment/json"
+)
+
+func TestInlayHints(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, "// | 1 + 2\r\n// | foo\r\ntext\r\n// | 3 km in m\r\n// | 4")
+
+	response, err := e.handleInlayHint(t.Context(), &lsproto.InlayHintParams{
+		TextDocument: textDocument(),
+		Range:        lsproto.Range{Start: position(0, 0), End: position(3, 0)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No hint for the line without a result, nor for the line after the range.
+	expected := []struct {
+		position lsproto.Position
+		label    string
+	}{
+		{position(0, 10), "3"},
+		{position(3, 14), "3000 meters"},
+	}
+	hints := *response.InlayHints
+	if len(hints) != len(expected) {
+		t.Fatalf("expected %d hints, got %d", len(expected), len(hints))
+	}
+	for i, hint := range hints {
+		if hint.Position != expected[i].position || *hint.Label.String != expected[i].label {
+			t.Errorf("expected %q at %v, got %q at %v", expected[i].label, expected[i].position, *hint.Label.String, hint.Position)
+		}
+	}
+}
+
+func TestReportResults(t *testing.T) {
+	refreshing := lsproto.WithClientCapabilities(t.Context(), &lsproto.ResolvedClientCapabilities{
+		Workspace: lsproto.ResolvedWorkspaceClientCapabilities{
+			InlayHint: lsproto.ResolvedInlayHintWorkspaceClientCapabilities{RefreshSupport: true},
+		},
+	})
+	e := newTestEngine(t)
+	previous := openTestDocument(e, "// | 1 + 2")
+	same := &document{uri: testUri, version: 2, text: "// | 1 + 2 ", interpretations: e.interpreter.Interpret("// | 1 + 2 ")}
+	changed := &document{uri: testUri, version: 3, text: "// | 1 + 3", interpretations: e.interpreter.Interpret("// | 1 + 3")}
+
+	cases := []struct {
+		name       string
+		inlayHints bool
+		previous   *document
+		doc        *document
+		expected   lsproto.Method
+	}{
+		{"report without inlay hints", false, previous, same, "custom/evaluationReport"},
+		{"refresh after a change", true, previous, changed, lsproto.MethodWorkspaceInlayHintRefresh},
+		{"refresh of a new document", true, nil, same, lsproto.MethodWorkspaceInlayHintRefresh},
+		{"nothing when results stayed the same", true, previous, same, ""},
+	}
+	for _, c := range cases {
+		e.inlayHints = c.inlayHints
+		if err := e.reportResults(refreshing, c.previous, c.doc); err != nil {
+			t.Fatal(err)
+		}
+		sent := sentMessages(e)
+		if c.expected == "" {
+			if len(sent) != 0 {
+				t.Errorf("%s: expected nothing to be sent, got %s", c.name, sent[0].AsRequest().Method)
+			}
+			continue
+		}
+		if len(sent) != 1 || sent[0].AsRequest().Method != c.expected {
+			t.Errorf("%s: expected %s, got %d messages", c.name, c.expected, len(sent))
+		}
+	}
+}
+
+func TestEvaluationReport(t *testing.T) {
+	e := newTestEngine(t)
+	doc := openTestDocument(e, "// | x = 2 km\n// | x +")
+	if err := e.sendEvaluationReport(doc); err != nil {
+		t.Fatal(err)
+	}
+	sent := sentMessages(e)
+	if len(sent) != 1 {
+		t.Fatalf("expected a report, got %d messages", len(sent))
+	}
+	data, err := json.Marshal(sent[0].AsRequest().Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"uri":"file:///notes.md","version":1,"interpretations":[` +
+		`{"LineIndex":0,"Column":4,"Text":" x = 2 km","EvalResult":"2 kilometers","Diagnostics":[]},` +
+		`{"LineIndex":1,"Column":4,"Text":" x +","EvalResult":"","Diagnostics":[{"range":{"start":{"line":1,"character":8},"end":{"line":1,"character":8}},"severity":1,"source":"puter","message":"Unrecognized prefix token EOF"}]}]}`
+	if string(data) != expected {
+		t.Errorf("expected the report to hold only what is rendered, got %s", data)
+	}
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"puter/logging"
+	lsproto "puter/lsp"
+)
+
+var logMessageTypes = map[logging.Level]lsproto.MessageType{
+	logging.LevelError:   lsproto.MessageTypeError,
+	logging.LevelWarn:    lsproto.MessageTypeWarning,
+	logging.LevelInfo:    lsproto.MessageTypeInfo,
+	logging.LevelVerbose: lsproto.MessageTypeLog,
+}
+
+// Forwards the log of the engine to the client. Messages up to clientLogLevel are sent as
+// `window/logMessage`, and whatever the trace value of the client asks for as `$/logTrace`,
+// see traceLevel.
+type clientLog struct {
+	e *Engine
+}
+
+var _ logging.Forwarder = clientLog{}
+
+func (c clientLog) Forwards(level logging.Level) bool {
+	return level <= c.e.clientLogLevel || level <= c.e.traceLevel()
+}
+
+// Messages are dropped when the outgoing queue is full, waiting for it to drain would
+// hang the write loop when it logs.
+func (c clientLog) Forward(level logging.Level, message string) {
+	if level <= c.e.clientLogLevel {
+		notification := lsproto.WindowLogMessageInfo.NewNotificationMessage(&lsproto.LogMessageParams{
+			Type:    logMessageTypes[level],
+			Message: message,
+		})
+		c.e.trySend(notification.Message())
+	}
+	if level <= c.e.traceLevel() {
+		notification := lsproto.LogTraceInfo.NewNotificationMessage(&lsproto.LogTraceParams{
+			Message: fmt.Sprintf("[%s] %s", level, message),
+		})
+		c.e.trySend(notification.Message())
+	}
+}
+
+// The most detailed level traced to the client: none when tracing is off, info and above
+// for `messages`, and everything for `verbose`.
+func (e *Engine) traceLevel() logging.Level {
+	trace, _ := e.trace.Load().(lsproto.TraceValue)
+	switch trace {
+	case lsproto.TraceValueMessages:
+		return logging.LevelInfo
+	case lsproto.TraceValueVerbose:
+		return logging.LevelVerbose
+	}
+	return logging.LevelError - 1
+}
+
+func (e *Engine) handleSetTrace(ctx context.Context, params *lsproto.SetTraceParams) error {
+	e.trace.Store(params.Value)
+	return nil
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"math"
+	"puter/logging"
+	lsproto "puter/lsp"
+	"testing"
+	"time"
+)
+
+func TestLoggingWhileTheQueueIsFull(t *testing.T) {
+	e := newTestEngine(t)
+	for range cap(e.outgoingQueue) {
+		e.outgoingQueue <- lsproto.WindowShowMessageInfo.NewNotificationMessage(&lsproto.ShowMessageParams{}).Message()
+	}
+
+	// The write loop logs a message it can't encode, it must not wait for itself to
+	// drain the queue.
+	written := make(chan error, 1)
+	go func() {
+		written <- e.write((&lsproto.ResponseMessage{ID: lsproto.NewID(lsproto.IntegerOrString{Integer: new(int32)}), Result: math.NaN()}).Message())
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing blocked on the log of its own failure")
+	}
+	if len(e.outgoingQueue) != cap(e.outgoingQueue) {
+		t.Errorf("expected the queue to stay as it was, got %d messages", len(e.outgoingQueue))
+	}
+}
+
+func TestForwardedLogLevel(t *testing.T) {
+	e := newTestEngine(t)
+	logged := func() []string {
+		messages := []string{}
+		for _, message := range sentMessages(e) {
+			messages = append(messages, message.AsRequest().Params.(*lsproto.LogMessageParams).Message)
+		}
+		return messages
+	}
+
+	e.logger.Info("settings changed")
+	e.logger.Warn("could not fetch")
+	if messages := logged(); len(messages) != 1 || messages[0] != "could not fetch" {
+		t.Errorf("expected only the warning to be sent, got %q", messages)
+	}
+
+	e.SetClientLogLevel(logging.LevelInfo)
+	e.logger.Info("settings changed")
+	e.logger.Log("read")
+	if messages := logged(); len(messages) != 1 || messages[0] != "settings changed" {
+		t.Errorf("expected info to be sent once asked for, got %q", messages)
+	}
+}
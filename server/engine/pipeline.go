@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"sync"
+	"time"
+)
+
+// Evaluation pipeline of an open document.
+//
+// Edits are applied to text right away, in the order they arrive, but evaluating them
+// waits for the document to settle: every edit restarts the debounce and cancels the
+// evaluation in flight, so that only the latest version is ever reported.
+type pipeline struct {
+	mu      sync.Mutex
+	uri     lsproto.DocumentUri
+	version int32
+	text    string
+	// The language the client opened the document as, which decides its comment markers.
+	languageId string
+	// Incremented by every scheduled evaluation. An evaluation only stores its result
+	// when nothing else was scheduled in the meantime.
+	generation int
+	// Whether the next evaluation has to start from scratch instead of reusing the
+	// interpretations of the last one, set when the options changed.
+	fresh  bool
+	timer  *time.Timer
+	cancel context.CancelFunc
+	closed bool
+	// Held while the results of an evaluation are sent, so that they go out in order.
+	// Sending waits while the outgoing queue is full, mu is not held then.
+	reportMu sync.Mutex
+}
+
+// Starts the pipeline of a document that was just opened, replacing the previous one if
+// the document was already open.
+func (e *Engine) openPipeline(uri lsproto.DocumentUri, languageId string, version int32, text string) *pipeline {
+	p := &pipeline{uri: uri, languageId: languageId, version: version, text: text}
+	e.pipelinesMu.Lock()
+	previous := e.pipelines[uri]
+	e.pipelines[uri] = p
+	e.pipelinesMu.Unlock()
+	if previous != nil {
+		previous.stop()
+	}
+	return p
+}
+
+func (e *Engine) getPipeline(uri lsproto.DocumentUri) *pipeline {
+	e.pipelinesMu.Lock()
+	defer e.pipelinesMu.Unlock()
+	return e.pipelines[uri]
+}
+
+// Stops the pipeline of a closed document. Returns nil if it was not open.
+func (e *Engine) closePipeline(uri lsproto.DocumentUri) *pipeline {
+	e.pipelinesMu.Lock()
+	p := e.pipelines[uri]
+	delete(e.pipelines, uri)
+	e.pipelinesMu.Unlock()
+	if p != nil {
+		p.stop()
+	}
+	return p
+}
+
+func (e *Engine) allPipelines() []*pipeline {
+	e.pipelinesMu.Lock()
+	defer e.pipelinesMu.Unlock()
+	pipelines := []*pipeline{}
+	for _, p := range e.pipelines {
+		pipelines = append(pipelines, p)
+	}
+	return pipelines
+}
+
+// Cancels whatever is pending and makes sure that nothing is reported afterwards.
+func (p *pipeline) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.abort()
+}
+
+// Stops the pending timer and cancels the evaluation in flight. Callers hold p.mu.
+func (p *pipeline) abort() {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// Evaluates the current text of the pipeline once delay passed without another call,
+// superseding anything scheduled before.
+func (e *Engine) scheduleEvaluation(ctx context.Context, p *pipeline, delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.abort()
+	p.generation++
+
+	ctx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+	generation, version, text, fresh := p.generation, p.version, p.text, p.fresh
+	p.timer = time.AfterFunc(delay, func() {
+		defer cancel()
+		e.evaluatePipeline(ctx, p, generation, version, text, fresh)
+	})
+}
+
+func (e *Engine) evaluatePipeline(ctx context.Context, p *pipeline, generation int, version int32, text string, fresh bool) {
+	previous := e.documents.get(p.uri)
+	var cached []*interpreter.Interpretation
+	if previous != nil && !fresh {
+		cached = previous.interpretations
+	}
+	start := time.Now()
+	progress := e.startProgress("Evaluating", path.Base(string(p.uri)))
+	interpretations, err := e.interpreter.ReinterpretLanguage(ctx, p.languageId, cached, text)
+	progress.end("")
+	if err != nil {
+		e.logger.Log("evaluation of '", p.uri, "' version ", version, " superseded after ", time.Since(start))
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed || p.generation != generation {
+		p.mu.Unlock()
+		return
+	}
+	p.fresh = false
+	doc := &document{
+		uri:             p.uri,
+		version:         version,
+		text:            text,
+		interpretations: interpretations,
+	}
+	e.documents.set(doc)
+	p.mu.Unlock()
+
+	p.reportMu.Lock()
+	defer p.reportMu.Unlock()
+	// A later evaluation was stored or the document was closed in the meantime.
+	if e.documents.get(p.uri) != doc {
+		return
+	}
+	if err := e.reportDocument(ctx, previous, doc); err != nil {
+		e.logger.Error("could not report evaluation of '", p.uri, "': ", err)
+	}
+}
+
+// Returns the interpretations of the latest text of an open document. The evaluation of
+// the pipeline is used when it is done, otherwise the text is evaluated right away rather
+// than waiting for the debounce.
+func (e *Engine) latestInterpretations(ctx context.Context, uri lsproto.DocumentUri) (int32, []*interpreter.Interpretation, error) {
+	p := e.getPipeline(uri)
+	if p == nil {
+		return 0, nil, fmt.Errorf("%w: %s is not open", lsproto.ErrorCodeInvalidParams, uri)
+	}
+	p.mu.Lock()
+	version, text, fresh := p.version, p.text, p.fresh
+	p.mu.Unlock()
+
+	doc := e.getDocument(uri)
+	if doc != nil && doc.version == version && doc.text == text && !fresh {
+		return version, doc.interpretations, nil
+	}
+	var cached []*interpreter.Interpretation
+	if doc != nil && !fresh {
+		cached = doc.interpretations
+	}
+	interpretations, err := e.interpreter.ReinterpretLanguage(ctx, p.languageId, cached, text)
+	return version, interpretations, err
+}
@@ -0,0 +1,29 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"testing"
+	"time"
+)
+
+func TestStoppingWhileTheQueueIsFull(t *testing.T) {
+	e := newTestEngine(t)
+	for range cap(e.outgoingQueue) {
+		e.outgoingQueue <- lsproto.WindowShowMessageInfo.NewNotificationMessage(&lsproto.ShowMessageParams{}).Message()
+	}
+	p := e.openPipeline(testUri, "markdown", 1, "// | 1 + 2\n")
+	e.scheduleEvaluation(t.Context(), p, 0)
+	waitFor(t, "the evaluation to be stored", func() bool { return e.getDocument(testUri) != nil })
+
+	// The evaluation waits for the queue to report its diagnostics, stopping must not.
+	stopped := make(chan struct{})
+	go func() {
+		e.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopping waited for the evaluation to be reported")
+	}
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+	"sync"
+	"time"
+)
+
+// How long an operation runs before the client is told about it. Most evaluations and
+// fetches finish well before, and progress that flashes by is only distracting.
+const progressDelay = 500 * time.Millisecond
+
+// How long to wait for the client to answer `window/workDoneProgress/create`.
+const progressCreateTimeout = 5 * time.Second
+
+// Work done progress of an operation that may take a while, created by the server.
+//
+// Nothing is shown when the operation ends within progressDelay, or when the client
+// doesn't support server initiated progress.
+type workDoneProgress struct {
+	e       *Engine
+	title   string
+	message string
+	timer   *time.Timer
+	// Guards token and ended, begin and end run on different goroutines.
+	mu    sync.Mutex
+	token *lsproto.IntegerOrString
+	ended bool
+}
+
+func (e *Engine) startProgress(title string, message string) *workDoneProgress {
+	p := &workDoneProgress{e: e, title: title, message: message}
+	if e.clientCapabilities.Window.WorkDoneProgress {
+		p.timer = time.AfterFunc(progressDelay, p.begin)
+	}
+	return p
+}
+
+func (p *workDoneProgress) begin() {
+	p.mu.Lock()
+	ended := p.ended
+	p.mu.Unlock()
+	if ended {
+		return
+	}
+
+	// The lock isn't held while the client answers, end must not wait for that.
+	ctx, cancel := context.WithTimeout(p.e.ctx, progressCreateTimeout)
+	defer cancel()
+	token := lsproto.IntegerOrString{String: utils.PointerTo(fmt.Sprintf("puter/%d", p.e.progressSeq.Add(1)))}
+	_, err := sendClientRequest(ctx, p.e, lsproto.WindowWorkDoneProgressCreateInfo, &lsproto.WorkDoneProgressCreateParams{Token: token})
+	if err != nil {
+		p.e.logger.Warn("could not create progress '", p.title, "': ", err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// The operation may have ended while the token was created, then there is nothing
+	// left to show.
+	if p.ended {
+		return
+	}
+	p.token = &token
+	p.e.sendProgress(token, &lsproto.WorkDoneProgressBegin{
+		Title:   p.title,
+		Message: utils.PointerTo(p.message),
+	})
+}
+
+// Ends the progress, if it was shown at all, with an optional message about the outcome.
+func (p *workDoneProgress) end(message string) {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.mu.Lock()
+	p.ended = true
+	token := p.token
+	p.mu.Unlock()
+	if token == nil {
+		return
+	}
+	end := &lsproto.WorkDoneProgressEnd{}
+	if message != "" {
+		end.Message = utils.PointerTo(message)
+	}
+	p.e.sendProgress(*token, end)
+}
+
+func (e *Engine) sendProgress(token lsproto.IntegerOrString, value any) {
+	notification := lsproto.ProgressInfo.NewNotificationMessage(&lsproto.ProgressParams{Token: token, Value: value})
+	if err := e.send(notification.Message()); err != nil {
+		e.logger.Warn("could not report progress: ", err)
+	}
+}
+
+// Shows message to the user, for problems that persist rather than ones tied to a line,
+// those are diagnostics.
+func (e *Engine) showMessage(messageType lsproto.MessageType, message string) {
+	e.logger.Warn(message)
+	notification := lsproto.WindowShowMessageInfo.NewNotificationMessage(&lsproto.ShowMessageParams{
+		Type:    messageType,
+		Message: message,
+	})
+	if err := e.send(notification.Message()); err != nil {
+		e.logger.Warn("could not show message: ", err)
+	}
+}
+
+// Observes the exchange rates, see unit.FetchObserver. Shows progress while rates are
+// fetched and tells the user when the exchange rate service can't be reached, once until
+// it can be reached again.
+func (e *Engine) observeFetch(base string) func(error, *unit.FrankfurterResponse) {
+	progress := e.startProgress("Fetching exchange rates", fmt.Sprintf("Rates for %s", base))
+	return func(err error, fallback *unit.FrankfurterResponse) {
+		progress.end("")
+		if err == nil {
+			e.ratesUnreachable.Store(false)
+			return
+		}
+		// Fetching is stopped when the server shuts down, that is no failure. Of several
+		// failures in a row, only the first one is shown.
+		if errors.Is(err, context.Canceled) || e.ratesUnreachable.Swap(true) {
+			return
+		}
+		if fallback != nil {
+			e.showMessage(lsproto.MessageTypeWarning, fmt.Sprintf("Exchange rate service unreachable, using cached rates from %s", fallback.Date))
+			return
+		}
+		e.showMessage(lsproto.MessageTypeError, fmt.Sprintf("Exchange rate service unreachable, converting %s is not possible: %s", base, err))
+	}
+}
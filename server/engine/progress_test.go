@@ -0,0 +1,87 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"testing"
+	"time"
+)
+
+// Progress reports the engine sent so far, WorkDoneProgressBegin or WorkDoneProgressEnd.
+func sentProgress(e *Engine) []any {
+	reports := []any{}
+	for _, message := range sentMessages(e) {
+		if message.Kind == lsproto.MessageKindNotification && message.AsRequest().Method == lsproto.MethodProgress {
+			reports = append(reports, message.AsRequest().Params.(*lsproto.ProgressParams).Value)
+		}
+	}
+	return reports
+}
+
+func TestProgress(t *testing.T) {
+	e := newTestEngine(t)
+	e.clientCapabilities.Window.WorkDoneProgress = true
+	progress := e.startProgress("Fetching exchange rates", "Rates for USD")
+
+	req := answerClientRequest(t, e, "null")
+	if req.Method != lsproto.MethodWindowWorkDoneProgressCreate {
+		t.Fatalf("expected the progress to be created, got %s", req.Method)
+	}
+	waitFor(t, "the progress to begin", func() bool {
+		progress.mu.Lock()
+		defer progress.mu.Unlock()
+		return progress.token != nil
+	})
+	progress.end("done")
+
+	reports := sentProgress(e)
+	if len(reports) != 2 {
+		t.Fatalf("expected begin and end, got %#v", reports)
+	}
+	if begin, ok := reports[0].(*lsproto.WorkDoneProgressBegin); !ok || begin.Title != "Fetching exchange rates" {
+		t.Errorf("expected the progress to begin, got %#v", reports[0])
+	}
+	if end, ok := reports[1].(*lsproto.WorkDoneProgressEnd); !ok || end.Message == nil || *end.Message != "done" {
+		t.Errorf("expected the progress to end, got %#v", reports[1])
+	}
+}
+
+func TestProgressEndingBeforeItIsShown(t *testing.T) {
+	e := newTestEngine(t)
+	e.clientCapabilities.Window.WorkDoneProgress = true
+	progress := e.startProgress("Fetching exchange rates", "Rates for USD")
+	progress.end("")
+
+	time.Sleep(2 * progressDelay)
+	if messages := sentMessages(e); len(messages) != 0 {
+		t.Errorf("expected nothing to be sent, got %d messages", len(messages))
+	}
+}
+
+func TestProgressEndingWhileItIsCreated(t *testing.T) {
+	e := newTestEngine(t)
+	e.clientCapabilities.Window.WorkDoneProgress = true
+	progress := e.startProgress("Fetching exchange rates", "Rates for USD")
+	waitFor(t, "the progress to be created", func() bool {
+		e.pendingServerRequestsMu.Lock()
+		defer e.pendingServerRequestsMu.Unlock()
+		return len(e.pendingServerRequests) > 0
+	})
+
+	// The client hasn't answered yet, ending must not wait for it.
+	ended := make(chan struct{})
+	go func() {
+		progress.end("")
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("ending waited for the client to create the progress")
+	}
+
+	answerClientRequest(t, e, "null")
+	time.Sleep(10 * time.Millisecond)
+	if reports := sentProgress(e); len(reports) != 0 {
+		t.Errorf("expected the ended progress not to begin, got %#v", reports)
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/report"
+	"puter/utils"
+)
+
+// Request that returns the results of a document, or of some text, for clients that don't
+// handle custom/evaluationReport. The schema is documented in protocol.md.
+const puterEvaluateMethod lsproto.Method = "puter/evaluate"
+
+var puterEvaluateInfo = lsproto.RequestInfo[any, *puterEvaluateResult]{Method: puterEvaluateMethod}
+
+type puterEvaluateParams struct {
+	// The latest version of the schema when left out. Older versions are not supported yet.
+	SchemaVersion *int `json:"schemaVersion,omitzero"`
+	// Either the uri of an open document or the text to evaluate.
+	Uri  *lsproto.DocumentUri `json:"uri,omitzero"`
+	Text *string              `json:"text,omitzero"`
+	// The LSP language id of the text, whose comment markers pipe lines start with.
+	LanguageId string `json:"languageId,omitzero"`
+	// Only pipe lines from the line of the start to the line of the end are returned.
+	Range *lsproto.Range `json:"range,omitzero"`
+}
+
+type puterEvaluateResult struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	Uri           *lsproto.DocumentUri `json:"uri,omitzero"`
+	// Version of the document the results are for.
+	Version *int32         `json:"version,omitzero"`
+	Lines   []*report.Line `json:"lines"`
+}
+
+func (e *Engine) handlePuterEvaluate(ctx context.Context, rawParams any, _ *lsproto.RequestMessage) (*puterEvaluateResult, error) {
+	if rawParams == nil {
+		return nil, fmt.Errorf("%w: %s expects params", lsproto.ErrorCodeInvalidParams, puterEvaluateMethod)
+	}
+	params := &puterEvaluateParams{}
+	if err := decodeValue(string(puterEvaluateMethod), rawParams, params); err != nil {
+		return nil, err
+	}
+	if params.SchemaVersion != nil && *params.SchemaVersion != report.SchemaVersion {
+		return nil, fmt.Errorf("%w: schema version %d is not supported, the server speaks version %d", lsproto.ErrorCodeInvalidParams, *params.SchemaVersion, report.SchemaVersion)
+	}
+	if (params.Uri == nil) == (params.Text == nil) {
+		return nil, fmt.Errorf("%w: %s expects either a uri or a text", lsproto.ErrorCodeInvalidParams, puterEvaluateMethod)
+	}
+
+	result := &puterEvaluateResult{SchemaVersion: report.SchemaVersion, Lines: []*report.Line{}}
+	var interpretations []*interpreter.Interpretation
+	if params.Uri != nil {
+		version, latest, err := e.latestInterpretations(ctx, *params.Uri)
+		if err != nil {
+			return nil, err
+		}
+		result.Uri = params.Uri
+		result.Version = utils.PointerTo(version)
+		interpretations = latest
+	} else {
+		evaluated, err := e.interpreter.ReinterpretLanguage(ctx, params.LanguageId, nil, *params.Text)
+		if err != nil {
+			return nil, err
+		}
+		interpretations = evaluated
+	}
+
+	for _, interpretation := range interpretations {
+		if params.Range != nil && (interpretation.LineIndex < int(params.Range.Start.Line) || interpretation.LineIndex > int(params.Range.End.Line)) {
+			continue
+		}
+		result.Lines = append(result.Lines, report.NewLine(interpretation))
+	}
+	return result, nil
+}
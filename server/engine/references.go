@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"puter/evaluation/ast"
+	"puter/evaluation/evaluator"
+	"puter/evaluation/evaluator/box"
+	"puter/evaluation/scanner"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+	"strings"
+)
+
+// A binding together with the pipe line it appears on.
+type occurrence struct {
+	interpretation *interpreter.Interpretation
+	binding        *evaluator.Binding
+}
+
+func (o occurrence) location(uri lsproto.DocumentUri) lsproto.Location {
+	return lsproto.Location{Uri: uri, Range: o.interpretation.BindingRange(o.binding)}
+}
+
+// Returns the variable under the given position, nil if there is none.
+func occurrenceAt(doc *document, position lsproto.Position) *occurrence {
+	interpretation := doc.interpretationAt(int(position.Line))
+	if interpretation == nil {
+		return nil
+	}
+	binding := bindingAt(interpretation, int(position.Character))
+	if binding == nil {
+		return nil
+	}
+	return &occurrence{interpretation, binding}
+}
+
+// Every read and assignment of name across the pipe lines of the document.
+//
+// All pipe lines of a document share a single heap, so a reassignment further down
+// is the same variable rather than a new one.
+func occurrencesOf(doc *document, name string) []occurrence {
+	occurrences := []occurrence{}
+	for _, interpretation := range doc.interpretations {
+		for _, binding := range interpretation.Bindings {
+			if binding.Name == name {
+				occurrences = append(occurrences, occurrence{interpretation, binding})
+			}
+		}
+	}
+	return occurrences
+}
+
+// Returns the assignment that the given occurrence reads from: the last assignment
+// of the same name above it. Assignments resolve to themselves.
+func definitionOf(doc *document, target *occurrence) *occurrence {
+	if target.binding.Assigned {
+		return target
+	}
+	var found *occurrence
+	for _, o := range occurrencesOf(doc, target.binding.Name) {
+		if o.interpretation.LineIndex >= target.interpretation.LineIndex {
+			break
+		}
+		if o.binding.Assigned {
+			found = &o
+		}
+	}
+	return found
+}
+
+func (e *Engine) handleDefinition(ctx context.Context, params *lsproto.DefinitionParams, _ *lsproto.RequestMessage) (lsproto.DefinitionResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.DefinitionResponse{}, nil
+	}
+	target := occurrenceAt(doc, params.Position)
+	if target == nil {
+		return lsproto.DefinitionResponse{}, nil
+	}
+	definition := definitionOf(doc, target)
+	if definition == nil {
+		return lsproto.DefinitionResponse{}, nil
+	}
+	return lsproto.DefinitionResponse{
+		Location: utils.PointerTo(definition.location(doc.uri)),
+	}, nil
+}
+
+func (e *Engine) handleReferences(ctx context.Context, params *lsproto.ReferenceParams, _ *lsproto.RequestMessage) (lsproto.ReferencesResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.ReferencesResponse{}, nil
+	}
+	target := occurrenceAt(doc, params.Position)
+	if target == nil {
+		return lsproto.ReferencesResponse{}, nil
+	}
+
+	includeDeclaration := params.Context != nil && params.Context.IncludeDeclaration
+	locations := []lsproto.Location{}
+	for _, o := range occurrencesOf(doc, target.binding.Name) {
+		if o.binding.Assigned && !includeDeclaration {
+			continue
+		}
+		locations = append(locations, o.location(doc.uri))
+	}
+	return lsproto.ReferencesResponse{Locations: &locations}, nil
+}
+
+func (e *Engine) handlePrepareRename(ctx context.Context, params *lsproto.PrepareRenameParams, _ *lsproto.RequestMessage) (lsproto.PrepareRenameResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.PrepareRenameResponse{}, nil
+	}
+	target := occurrenceAt(doc, params.Position)
+	if target == nil {
+		return lsproto.PrepareRenameResponse{}, nil
+	}
+	return lsproto.PrepareRenameResponse{
+		Range: utils.PointerTo(target.interpretation.BindingRange(target.binding)),
+	}, nil
+}
+
+func (e *Engine) handleRename(ctx context.Context, params *lsproto.RenameParams, _ *lsproto.RequestMessage) (lsproto.RenameResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.RenameResponse{}, nil
+	}
+	target := occurrenceAt(doc, params.Position)
+	if target == nil {
+		return lsproto.RenameResponse{}, nil
+	}
+	if !isIdentifier(params.NewName) {
+		return lsproto.RenameResponse{}, fmt.Errorf("%w: %q is not a valid variable name", lsproto.ErrorCodeInvalidParams, params.NewName)
+	}
+	if isReservedName(params.NewName) {
+		return lsproto.RenameResponse{}, fmt.Errorf("%w: %q is already a unit, a currency or a builtin", lsproto.ErrorCodeInvalidParams, params.NewName)
+	}
+
+	// Bindings only ever come from pipe lines, so the surrounding code is never touched.
+	edits := []*lsproto.TextEdit{}
+	for _, o := range occurrencesOf(doc, target.binding.Name) {
+		edits = append(edits, &lsproto.TextEdit{
+			Range:   o.interpretation.BindingRange(o.binding),
+			NewText: params.NewName,
+		})
+	}
+	return lsproto.RenameResponse{
+		WorkspaceEdit: &lsproto.WorkspaceEdit{
+			Changes: &map[lsproto.DocumentUri][]*lsproto.TextEdit{
+				doc.uri: edits,
+			},
+		},
+	}, nil
+}
+
+// Reports whether name scans as exactly one identifier token, so not a keyword or a number.
+func isIdentifier(name string) bool {
+	s := scanner.NewScanner(name)
+	token := s.Next()
+	return token.Type == ast.IDENT && token.Literal == name && s.Next().Type == ast.EOF
+}
+
+// Reports whether name means something in every pipe line already. A variable renamed to
+// it would change what its references evaluate to.
+func isReservedName(name string) bool {
+	_, isBuiltin := evaluator.Builtins[name]
+	return isBuiltin || isUnitName(name) || isDefaultVariable(name)
+}
+
+// Reports whether name is one of the values every heap starts out with, like pi.
+func isDefaultVariable(name string) bool {
+	return name == "pi" || name == "e"
+}
+
+// Reports whether name is a unit, a currency or a number format.
+func isUnitName(name string) bool {
+	if ok, _ := unit.IsFixedUnitKeyword(name); ok {
+		return true
+	}
+	if _, ok := unit.FiatCurrencies[strings.ToUpper(name)]; ok {
+		return true
+	}
+	switch box.NumberType(strings.ToLower(name)) {
+	case box.Decimal, box.Hex, box.Binary:
+		return true
+	}
+	return false
+}
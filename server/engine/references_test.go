@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"cmp"
+	"errors"
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var referencesText = strings.Join([]string{
+	"// | price = 10 usd",
+	"const price = 3 // price in code",
+	"// | price * 2",
+	"// | price = price + 1",
+	"// | price",
+}, "\n")
+
+func TestDefinition(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, referencesText)
+	cases := []struct {
+		position lsproto.Position
+		// Line of the assignment, -1 for none.
+		expected int
+	}{
+		{position(2, 6), 0},
+		{position(3, 14), 0},
+		{position(4, 6), 3},
+		{position(0, 6), 0},
+		{position(1, 8), -1},
+	}
+	for _, c := range cases {
+		response, err := e.handleDefinition(t.Context(), &lsproto.DefinitionParams{TextDocument: textDocument(), Position: c.position}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.expected < 0 {
+			if response.Location != nil {
+				t.Errorf("%v: expected no definition, got %v", c.position, response.Location.Range)
+			}
+			continue
+		}
+		expected := lsproto.Range{Start: position(uint32(c.expected), 5), End: position(uint32(c.expected), 10)}
+		if response.Location == nil || response.Location.Range != expected {
+			t.Errorf("%v: expected %v, got %v", c.position, expected, response.Location)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, referencesText)
+	for _, includeDeclaration := range []bool{false, true} {
+		response, err := e.handleReferences(t.Context(), &lsproto.ReferenceParams{
+			TextDocument: textDocument(),
+			Position:     position(4, 6),
+			Context:      &lsproto.ReferenceContext{IncludeDeclaration: includeDeclaration},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []lsproto.Position{position(2, 5), position(3, 13), position(4, 5)}
+		if includeDeclaration {
+			// A line reads its variables before it assigns them.
+			expected = []lsproto.Position{position(0, 5), position(2, 5), position(3, 13), position(3, 5), position(4, 5)}
+		}
+		got := []lsproto.Position{}
+		for _, location := range *response.Locations {
+			got = append(got, location.Range.Start)
+		}
+		if !slices.Equal(got, expected) {
+			t.Errorf("includeDeclaration %v: expected %v, got %v", includeDeclaration, expected, got)
+		}
+	}
+}
+
+func TestRenameOnlyTouchesPipeLines(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, referencesText)
+	response, err := e.handleRename(t.Context(), &lsproto.RenameParams{TextDocument: textDocument(), Position: position(2, 6), NewName: "cost"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits := (*response.WorkspaceEdit.Changes)[testUri]
+	// Applied from the end so that the ranges of earlier edits stay valid.
+	slices.SortFunc(edits, func(a, b *lsproto.TextEdit) int {
+		return cmp.Or(cmp.Compare(b.Range.Start.Line, a.Range.Start.Line), cmp.Compare(b.Range.Start.Character, a.Range.Start.Character))
+	})
+	lines := strings.Split(referencesText, "\n")
+	for _, edit := range edits {
+		line := lines[edit.Range.Start.Line]
+		lines[edit.Range.Start.Line] = line[:edit.Range.Start.Character] + edit.NewText + line[edit.Range.End.Character:]
+	}
+	expected := strings.Join([]string{
+		"// | cost = 10 usd",
+		"const price = 3 // price in code",
+		"// | cost * 2",
+		"// | cost = cost + 1",
+		"// | cost",
+	}, "\n")
+	if renamed := strings.Join(lines, "\n"); renamed != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, renamed)
+	}
+}
+
+func TestRenameRejectsInvalidNames(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, referencesText)
+	for _, name := range []string{"in", "2x", "a b", "", "km", "usd", "EUR", "sqrt", "pi", "hex"} {
+		_, err := e.handleRename(t.Context(), &lsproto.RenameParams{TextDocument: textDocument(), Position: position(2, 6), NewName: name}, nil)
+		if !errors.Is(err, lsproto.ErrorCodeInvalidParams) {
+			t.Errorf("%q: expected invalid params, got %v", name, err)
+		}
+	}
+	prepared, err := e.handlePrepareRename(t.Context(), &lsproto.PrepareRenameParams{TextDocument: textDocument(), Position: position(1, 8)}, nil)
+	if err != nil || prepared.Range != nil {
+		t.Errorf("expected nothing to rename outside pipe lines, got %v, %v", prepared.Range, err)
+	}
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"puter/evaluation/ast"
+	"puter/evaluation/evaluator"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+)
+
+// Token types, in the order of the legend sent to the client. The encoded tokens refer
+// to them by index.
+var semanticTokenTypes = []lsproto.SemanticTokenType{
+	lsproto.SemanticTokenTypeNumber,
+	// Units, currencies and number formats, `m` in `2 m` or `hex` in `31 in hex`.
+	lsproto.SemanticTokenTypeType,
+	lsproto.SemanticTokenTypeFunction,
+	lsproto.SemanticTokenTypeVariable,
+	lsproto.SemanticTokenTypeKeyword,
+	lsproto.SemanticTokenTypeOperator,
+}
+
+// Token modifiers, each one is a bit of the encoded modifier set in legend order.
+var semanticTokenModifiers = []lsproto.SemanticTokenModifier{
+	lsproto.SemanticTokenModifierDeclaration,
+	lsproto.SemanticTokenModifierDefaultLibrary,
+}
+
+func semanticTokensLegend() *lsproto.SemanticTokensLegend {
+	legend := &lsproto.SemanticTokensLegend{
+		TokenTypes:     []string{},
+		TokenModifiers: []string{},
+	}
+	for _, tokenType := range semanticTokenTypes {
+		legend.TokenTypes = append(legend.TokenTypes, string(tokenType))
+	}
+	for _, modifier := range semanticTokenModifiers {
+		legend.TokenModifiers = append(legend.TokenModifiers, string(modifier))
+	}
+	return legend
+}
+
+// A classified token of a pipe line. Positions are characters within the document line.
+type semanticToken struct {
+	line      int
+	start     int
+	length    int
+	tokenType lsproto.SemanticTokenType
+	modifiers []lsproto.SemanticTokenModifier
+}
+
+func (e *Engine) handleSemanticTokensFull(ctx context.Context, params *lsproto.SemanticTokensParams, _ *lsproto.RequestMessage) (lsproto.SemanticTokensResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.SemanticTokensResponse{}, nil
+	}
+	return lsproto.SemanticTokensResponse{
+		SemanticTokens: &lsproto.SemanticTokens{
+			Data: encodeSemanticTokens(documentSemanticTokens(doc, 0, math.MaxInt)),
+		},
+	}, nil
+}
+
+func (e *Engine) handleSemanticTokensRange(ctx context.Context, params *lsproto.SemanticTokensRangeParams, _ *lsproto.RequestMessage) (lsproto.SemanticTokensRangeResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.SemanticTokensRangeResponse{}, nil
+	}
+	tokens := documentSemanticTokens(doc, int(params.Range.Start.Line), int(params.Range.End.Line))
+	return lsproto.SemanticTokensRangeResponse{
+		SemanticTokens: &lsproto.SemanticTokens{
+			Data: encodeSemanticTokens(tokens),
+		},
+	}, nil
+}
+
+// Classifies the tokens of every pipe line between the first and last line, inclusive.
+func documentSemanticTokens(doc *document, firstLine int, lastLine int) []*semanticToken {
+	tokens := []*semanticToken{}
+	for _, interpretation := range doc.interpretations {
+		if interpretation.LineIndex < firstLine || interpretation.LineIndex > lastLine {
+			continue
+		}
+		tokens = append(tokens, lineSemanticTokens(interpretation)...)
+	}
+	return tokens
+}
+
+// Classifies the tokens the scanner produces for a pipe line.
+//
+// Identifiers that resolve to nothing, a misspelled unit or an undefined variable, are
+// left out on purpose so that they keep the color of the surrounding comment.
+func lineSemanticTokens(interpretation *interpreter.Interpretation) []*semanticToken {
+	scanned := scanTokens(interpretation.Text)
+	tokens := []*semanticToken{}
+	add := func(token *ast.Token, tokenType lsproto.SemanticTokenType, modifiers ...lsproto.SemanticTokenModifier) {
+		tokens = append(tokens, &semanticToken{
+			line:      interpretation.LineIndex,
+			start:     interpretation.Column + token.StartPos(),
+			length:    len(token.Literal),
+			tokenType: tokenType,
+			modifiers: modifiers,
+		})
+	}
+
+	if interpreter.IsAccumulationCommand(strings.TrimSpace(interpretation.Text)) {
+		for _, token := range scanned {
+			add(token, lsproto.SemanticTokenTypeKeyword)
+		}
+		return tokens
+	}
+
+	bindings := map[int]*evaluator.Binding{}
+	for _, binding := range interpretation.Bindings {
+		bindings[binding.StartPos] = binding
+	}
+
+	for i, token := range scanned {
+		switch token.Type {
+		case ast.NUMBER:
+			add(token, lsproto.SemanticTokenTypeNumber)
+		case ast.IN, ast.TRUE, ast.FALSE:
+			add(token, lsproto.SemanticTokenTypeKeyword)
+		case ast.IDENT:
+			var previous, next ast.TokenType
+			if i > 0 {
+				previous = scanned[i-1].Type
+			}
+			if i+1 < len(scanned) {
+				next = scanned[i+1].Type
+			}
+
+			if i == 0 && token.Literal == interpreter.AssertKeyword && interpretation.Assertion != nil {
+				add(token, lsproto.SemanticTokenTypeKeyword)
+				continue
+			}
+			if binding, ok := bindings[token.StartPos()]; ok {
+				switch {
+				case binding.Assigned:
+					add(token, lsproto.SemanticTokenTypeVariable, lsproto.SemanticTokenModifierDeclaration)
+				case binding.Value != nil && isDefaultVariable(binding.Name):
+					add(token, lsproto.SemanticTokenTypeVariable, lsproto.SemanticTokenModifierDefaultLibrary)
+				case binding.Value != nil:
+					add(token, lsproto.SemanticTokenTypeVariable)
+				}
+				continue
+			}
+			if _, ok := evaluator.Builtins[token.Literal]; ok && next == ast.LPAREN {
+				add(token, lsproto.SemanticTokenTypeFunction, lsproto.SemanticTokenModifierDefaultLibrary)
+				continue
+			}
+			// Units follow a value, `2 m`, `(1 + 1) m`, `10% usd` or `2 m in cm`.
+			switch previous {
+			case ast.NUMBER, ast.RPAREN, ast.PERCENT, ast.IN, ast.IDENT:
+				if isUnitName(token.Literal) {
+					add(token, lsproto.SemanticTokenTypeType)
+				}
+			}
+		case ast.ILLEGAL, ast.LPAREN, ast.RPAREN, ast.COMMA:
+		default:
+			add(token, lsproto.SemanticTokenTypeOperator)
+		}
+	}
+	return tokens
+}
+
+// Encodes tokens into the relative format of the specification: five integers per token,
+// the line and start character relative to the previous token, the length, the index of
+// the type in the legend and the modifiers as a bit set. Tokens must be sorted.
+func encodeSemanticTokens(tokens []*semanticToken) []uint32 {
+	data := make([]uint32, 0, len(tokens)*5)
+	line, start := 0, 0
+	for _, token := range tokens {
+		deltaLine := token.line - line
+		deltaStart := token.start
+		if deltaLine == 0 {
+			deltaStart = token.start - start
+		}
+		data = append(data,
+			uint32(deltaLine),
+			uint32(deltaStart),
+			uint32(token.length),
+			uint32(slices.Index(semanticTokenTypes, token.tokenType)),
+			encodeModifiers(token.modifiers),
+		)
+		line, start = token.line, token.start
+	}
+	return data
+}
+
+func encodeModifiers(modifiers []lsproto.SemanticTokenModifier) uint32 {
+	var bits uint32
+	for _, modifier := range modifiers {
+		bits |= 1 << slices.Index(semanticTokenModifiers, modifier)
+	}
+	return bits
+}
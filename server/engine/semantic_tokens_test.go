@@ -0,0 +1,70 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSemanticTokens(t *testing.T) {
+	tokens := []*semanticToken{
+		{line: 1, start: 5, length: 1, tokenType: lsproto.SemanticTokenTypeVariable, modifiers: []lsproto.SemanticTokenModifier{lsproto.SemanticTokenModifierDeclaration}},
+		{line: 1, start: 9, length: 2, tokenType: lsproto.SemanticTokenTypeNumber},
+		{line: 4, start: 3, length: 4, tokenType: lsproto.SemanticTokenTypeFunction, modifiers: []lsproto.SemanticTokenModifier{lsproto.SemanticTokenModifierDeclaration, lsproto.SemanticTokenModifierDefaultLibrary}},
+	}
+	// The start is relative to the previous token on the same line only.
+	expected := []uint32{
+		1, 5, 1, 3, 1,
+		0, 4, 2, 0, 0,
+		3, 3, 4, 2, 3,
+	}
+	if data := encodeSemanticTokens(tokens); !slices.Equal(data, expected) {
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, strings.Join([]string{
+		"// | d = 2 km in m",
+		"text",
+		"// | sqrt(pi) + foo",
+		"// | assert 1 < 2",
+	}, "\n"))
+
+	full, err := e.handleSemanticTokensFull(t.Context(), &lsproto.SemanticTokensParams{TextDocument: textDocument()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint32{
+		0, 5, 1, 3, 1, // d, a declared variable
+		0, 2, 1, 5, 0, // =
+		0, 2, 1, 0, 0, // 2
+		0, 2, 2, 1, 0, // km
+		0, 3, 2, 4, 0, // in
+		0, 3, 1, 1, 0, // m
+		2, 5, 4, 2, 2, // sqrt, a builtin
+		0, 5, 2, 3, 2, // pi, a predefined variable
+		0, 4, 1, 5, 0, // +, foo is undefined and left out
+		1, 5, 6, 4, 0, // assert
+		0, 7, 1, 0, 0, // 1
+		0, 2, 1, 5, 0, // <
+		0, 2, 1, 0, 0, // 2
+	}
+	if data := full.SemanticTokens.Data; !slices.Equal(data, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, data)
+	}
+
+	ranged, err := e.handleSemanticTokensRange(t.Context(), &lsproto.SemanticTokensRangeParams{
+		TextDocument: textDocument(),
+		Range:        lsproto.Range{Start: position(1, 0), End: position(2, 0)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first token of a range is relative to the start of the document.
+	if data := ranged.SemanticTokens.Data; !slices.Equal(data, expected[30:45]) {
+		t.Errorf("expected\n%v\ngot\n%v", expected[30:45], data)
+	}
+}
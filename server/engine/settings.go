@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-json-experiment/json"
+)
+
+// Name of the configuration section the settings are read from, `puter.precision` and so on.
+const settingsSection = "puter"
+
+// How long to wait for the client to answer `workspace/configuration`.
+const configurationTimeout = 5 * time.Second
+
+// Settings of the `puter` configuration section. Missing fields keep their default.
+type Settings struct {
+	// Comment markers a pipe line can start with, `//` for `// | 1 + 2`, or that also end
+	// it, `<!-- | -->` for `<!-- | 1 + 2 -->`.
+	CommentMarkers []string `json:"commentMarkers"`
+	// Comment markers by language id, used instead of CommentMarkers for documents of
+	// those languages. They replace the built-in markers of a language, see
+	// interpreter.DefaultLanguageCommentMarkers.
+	LanguageCommentMarkers map[string][]string `json:"languageCommentMarkers"`
+	// Number of decimal places results are rounded to, -1 to print them as they are.
+	Precision int `json:"precision"`
+	// Currency that `sum` and the other accumulation commands total mixed currencies in.
+	DefaultCurrency string `json:"defaultCurrency"`
+	// Never fetch exchange rates, only use the ones fetched before.
+	Offline bool `json:"offline"`
+	// A frankfurter compatible `latest` endpoint to fetch exchange rates from.
+	ExchangeRateEndpoint string `json:"exchangeRateEndpoint"`
+	// What `^` means, "xor" or "power".
+	CaretOperator string `json:"caretOperator"`
+	// Milliseconds to wait after an edit before evaluating the document, each further
+	// edit restarts the wait.
+	EvaluationDebounce int `json:"evaluationDebounce"`
+}
+
+func defaultSettings() Settings {
+	options := interpreter.DefaultOptions()
+	return Settings{
+		CommentMarkers:       options.CommentMarkers,
+		Precision:            options.Precision,
+		DefaultCurrency:      options.DefaultCurrency,
+		Offline:              false,
+		ExchangeRateEndpoint: unit.DefaultExchangeRateEndpoint,
+		CaretOperator:        "xor",
+		EvaluationDebounce:   100,
+	}
+}
+
+// Reads settings from the raw value of the configuration section. Fields with an invalid
+// value keep their default, each of them is described in the returned problems.
+func decodeSettings(raw any) (Settings, []string) {
+	settings := defaultSettings()
+	if raw == nil {
+		return settings, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return settings, []string{err.Error()}
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return defaultSettings(), []string{err.Error()}
+	}
+
+	defaults := defaultSettings()
+	problems := []string{}
+	if len(settings.CommentMarkers) == 0 {
+		settings.CommentMarkers = defaults.CommentMarkers
+	}
+	for _, marker := range settings.CommentMarkers {
+		if !interpreter.ValidCommentMarker(marker) {
+			problems = append(problems, fmt.Sprintf("commentMarkers: %q is not a valid comment marker", marker))
+			settings.CommentMarkers = defaults.CommentMarkers
+			break
+		}
+	}
+	for _, language := range slices.Sorted(maps.Keys(settings.LanguageCommentMarkers)) {
+		for _, marker := range settings.LanguageCommentMarkers[language] {
+			if !interpreter.ValidCommentMarker(marker) {
+				problems = append(problems, fmt.Sprintf("languageCommentMarkers: %q is not a valid comment marker for %s", marker, language))
+				delete(settings.LanguageCommentMarkers, language)
+				break
+			}
+		}
+	}
+	if settings.Precision < -1 || settings.Precision > 15 {
+		problems = append(problems, fmt.Sprintf("precision: %d is not between -1 and 15", settings.Precision))
+		settings.Precision = defaults.Precision
+	}
+	if settings.DefaultCurrency != "" {
+		if _, ok := unit.FiatCurrencies[strings.ToUpper(settings.DefaultCurrency)]; !ok {
+			problems = append(problems, fmt.Sprintf("defaultCurrency: %q is not a known currency", settings.DefaultCurrency))
+			settings.DefaultCurrency = defaults.DefaultCurrency
+		}
+	}
+	if settings.ExchangeRateEndpoint == "" {
+		settings.ExchangeRateEndpoint = defaults.ExchangeRateEndpoint
+	} else if endpoint, err := url.Parse(settings.ExchangeRateEndpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		problems = append(problems, fmt.Sprintf("exchangeRateEndpoint: %q is not an http(s) URL", settings.ExchangeRateEndpoint))
+		settings.ExchangeRateEndpoint = defaults.ExchangeRateEndpoint
+	}
+	if settings.CaretOperator != "xor" && settings.CaretOperator != "power" {
+		problems = append(problems, fmt.Sprintf("caretOperator: %q is neither \"xor\" nor \"power\"", settings.CaretOperator))
+		settings.CaretOperator = defaults.CaretOperator
+	}
+	if settings.EvaluationDebounce < 0 || settings.EvaluationDebounce > 5000 {
+		problems = append(problems, fmt.Sprintf("evaluationDebounce: %d is not between 0 and 5000", settings.EvaluationDebounce))
+		settings.EvaluationDebounce = defaults.EvaluationDebounce
+	}
+	return settings, problems
+}
+
+func (s Settings) interpreterOptions() interpreter.Options {
+	languageCommentMarkers := interpreter.DefaultLanguageCommentMarkers()
+	maps.Copy(languageCommentMarkers, s.LanguageCommentMarkers)
+	return interpreter.Options{
+		CommentMarkers:         s.CommentMarkers,
+		LanguageCommentMarkers: languageCommentMarkers,
+		Precision:              s.Precision,
+		DefaultCurrency:        strings.ToLower(s.DefaultCurrency),
+		CaretIsExponent:        s.CaretOperator == "power",
+	}
+}
+
+func (e *Engine) evaluationDebounce() time.Duration {
+	e.settingsMu.Lock()
+	defer e.settingsMu.Unlock()
+	return time.Duration(e.settings.EvaluationDebounce) * time.Millisecond
+}
+
+func (e *Engine) handleDidChangeConfiguration(ctx context.Context, params *lsproto.DidChangeConfigurationParams) error {
+	// Clients either push the settings along, or only signal that they changed and
+	// expect them to be pulled.
+	if all, ok := params.Settings.(map[string]any); ok {
+		if section, ok := all[settingsSection]; ok {
+			return e.applySettings(ctx, section)
+		}
+	}
+	return e.pullSettings(ctx)
+}
+
+// Asks the client for the settings with `workspace/configuration` and applies them.
+func (e *Engine) pullSettings(ctx context.Context) error {
+	if !lsproto.GetClientCapabilities(ctx).Workspace.Configuration {
+		return nil
+	}
+	// Only the request times out, the evaluations applying the settings schedules outlive it.
+	requestCtx, cancel := context.WithTimeout(ctx, configurationTimeout)
+	defer cancel()
+	sections, err := sendClientRequest(requestCtx, e, lsproto.WorkspaceConfigurationInfo, &lsproto.ConfigurationParams{
+		Items: []*lsproto.ConfigurationItem{{Section: utils.PointerTo(settingsSection)}},
+	})
+	if err != nil {
+		e.logger.Warn("could not pull settings: ", err)
+		return nil
+	}
+	if len(sections) != 1 {
+		e.logger.Warn("expected a single configuration section, got ", len(sections))
+		return nil
+	}
+	return e.applySettings(ctx, sections[0])
+}
+
+// Applies the raw value of the `puter` section. Open documents are evaluated again, from
+// scratch, whenever a setting that affects their results changed.
+func (e *Engine) applySettings(ctx context.Context, raw any) error {
+	settings, problems := decodeSettings(raw)
+	for _, problem := range problems {
+		e.showMessage(lsproto.MessageTypeWarning, fmt.Sprintf("Invalid setting %s.%s, using the default instead", settingsSection, problem))
+	}
+
+	e.settingsMu.Lock()
+	previous := e.settings
+	e.settings = settings
+	e.settingsMu.Unlock()
+	if reflect.DeepEqual(previous, settings) {
+		return nil
+	}
+	e.logger.Info("settings changed: ", fmt.Sprintf("%+v", settings))
+
+	// The debounce only affects edits from now on, results stay the same.
+	previous.EvaluationDebounce = settings.EvaluationDebounce
+	if reflect.DeepEqual(previous, settings) {
+		return nil
+	}
+	e.interpreter.SetOptions(settings.interpreterOptions())
+	e.exchangeRates.Configure(settings.ExchangeRateEndpoint, settings.Offline)
+
+	for _, p := range e.allPipelines() {
+		p.mu.Lock()
+		p.fresh = true
+		p.mu.Unlock()
+		e.scheduleEvaluation(ctx, p, 0)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"testing"
+)
+
+func TestPulledSettingsReevaluateOpenDocuments(t *testing.T) {
+	e := newTestEngine(t)
+	ctx := lsproto.WithClientCapabilities(t.Context(), &lsproto.ResolvedClientCapabilities{
+		Workspace: lsproto.ResolvedWorkspaceClientCapabilities{Configuration: true},
+	})
+	err := e.handleTextDocumentDidOpen(ctx, &lsproto.DidOpenTextDocumentParams{
+		TextDocument: &lsproto.TextDocumentItem{Uri: testUri, LanguageId: "markdown", Version: 1, Text: "// | 1 / 3\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := func() string {
+		if doc := e.getDocument(testUri); doc != nil && len(doc.interpretations) == 1 {
+			return doc.interpretations[0].EvalResult
+		}
+		return ""
+	}
+	waitFor(t, "the document to be evaluated", func() bool { return result() != "" })
+
+	pulled := make(chan error, 1)
+	go func() { pulled <- e.pullSettings(ctx) }()
+	answerClientRequest(t, e, `[{"precision": 4}]`)
+	if err := <-pulled; err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the document to be evaluated with the pulled precision", func() bool { return result() == "0.3333" })
+}
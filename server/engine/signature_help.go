@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"puter/evaluation/ast"
+	"puter/evaluation/evaluator"
+	"puter/evaluation/evaluator/box"
+	lsproto "puter/lsp"
+	"puter/utils"
+	"strings"
+)
+
+// How an accepted box type reads in the documentation of a parameter.
+var boxTypeDescriptions = map[box.BoxType]string{
+	box.NUMBER_BOX:     "number",
+	box.PERCENT_BOX:    "percentage",
+	box.CURRENCY_BOX:   "currency",
+	box.FIXED_UNIT_BOX: "unit",
+	box.BOOLEAN_BOX:    "boolean",
+}
+
+func (e *Engine) handleSignatureHelp(ctx context.Context, params *lsproto.SignatureHelpParams, _ *lsproto.RequestMessage) (lsproto.SignatureHelpResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.SignatureHelpResponse{}, nil
+	}
+	lineIndex := int(params.Position.Line)
+	interpretation := doc.interpretationAt(lineIndex)
+	if interpretation == nil {
+		return lsproto.SignatureHelpResponse{}, nil
+	}
+
+	line := doc.line(lineIndex)
+	cursor := min(int(params.Position.Character), len(line))
+	if cursor < interpretation.Column {
+		return lsproto.SignatureHelpResponse{}, nil
+	}
+	name, argument, ok := enclosingCall(scanTokens(line[interpretation.Column:cursor]))
+	if !ok {
+		return lsproto.SignatureHelpResponse{}, nil
+	}
+	builtin, ok := evaluator.Builtins[name]
+	if !ok {
+		return lsproto.SignatureHelpResponse{}, nil
+	}
+
+	labelOffsets := lsproto.GetClientCapabilities(ctx).TextDocument.SignatureHelp.SignatureInformation.ParameterInformation.LabelOffsetSupport
+	return lsproto.SignatureHelpResponse{
+		SignatureHelp: &lsproto.SignatureHelp{
+			Signatures:      []*lsproto.SignatureInformation{signatureInformation(name, builtin, labelOffsets)},
+			ActiveSignature: utils.PointerTo(uint32(0)),
+			ActiveParameter: &lsproto.UintegerOrNull{Uinteger: utils.PointerTo(uint32(argument))},
+		},
+	}, nil
+}
+
+// Finds the innermost call that the end of the tokens is inside of, and the index of the
+// argument being typed. Calls don't have to be closed, they rarely are while typing.
+//
+//	lerp(1, 2|       -> lerp, 1
+//	lerp(1, (2 + 3|  -> lerp, 1
+//	sqrt(2) + |      -> not in a call
+func enclosingCall(tokens []*ast.Token) (string, int, bool) {
+	depth := 0
+	argument := 0
+	for i := len(tokens) - 1; i >= 0; i-- {
+		switch tokens[i].Type {
+		case ast.RPAREN:
+			depth++
+		case ast.COMMA:
+			if depth == 0 {
+				argument++
+			}
+		case ast.LPAREN:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if i > 0 && tokens[i-1].Type == ast.IDENT {
+				return tokens[i-1].Literal, argument, true
+			}
+			// A parenthesized expression, the call may still be further out.
+			argument = 0
+		}
+	}
+	return "", 0, false
+}
+
+func signatureInformation(name string, builtin evaluator.Builtin, labelOffsets bool) *lsproto.SignatureInformation {
+	label := builtin.Signature(name)
+	parameters := []*lsproto.ParameterInformation{}
+	// Parameters are located by offset when the client allows it, a name like `v` would
+	// otherwise match the first `v` of `invLerp`.
+	offset := len(name) + 1
+	for _, param := range builtin.Params {
+		information := &lsproto.ParameterInformation{
+			Documentation: &lsproto.StringOrMarkupContent{
+				String: utils.PointerTo(describeParam(param)),
+			},
+		}
+		if labelOffsets {
+			information.Label.Tuple = &[2]uint32{uint32(offset), uint32(offset + len(param.Name))}
+		} else {
+			information.Label.String = utils.PointerTo(param.Name)
+		}
+		offset += len(param.Name) + len(", ")
+		parameters = append(parameters, information)
+	}
+
+	return &lsproto.SignatureInformation{
+		Label: label,
+		Documentation: &lsproto.StringOrMarkupContent{
+			String: utils.PointerTo(builtin.Description),
+		},
+		Parameters: &parameters,
+	}
+}
+
+// Describes a parameter and what it accepts, "the divisor, a number, percentage, currency or unit".
+func describeParam(param evaluator.BuiltinParam) string {
+	accepts := []string{}
+	for _, boxType := range param.Accepts {
+		accepts = append(accepts, boxTypeDescriptions[boxType])
+	}
+	if len(accepts) == 0 {
+		return param.Description
+	}
+	last := accepts[len(accepts)-1]
+	if len(accepts) > 1 {
+		last = strings.Join(accepts[:len(accepts)-1], ", ") + " or " + last
+	}
+	return fmt.Sprintf("%s, a %s", param.Description, last)
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"testing"
+)
+
+func TestEnclosingCall(t *testing.T) {
+	cases := []struct {
+		text     string
+		name     string
+		argument int
+		ok       bool
+	}{
+		{"lerp(", "lerp", 0, true},
+		{"lerp(1, 2", "lerp", 1, true},
+		{"lerp(1, (2 + 3", "lerp", 1, true},
+		{"lerp(1, sqrt(4), ", "lerp", 2, true},
+		{"lerp(1, sqrt(4", "sqrt", 0, true},
+		{"lerp(1, mod(4, 2) + 1, 3", "lerp", 2, true},
+		{"sqrt(2) + ", "", 0, false},
+		{"(1, 2", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, c := range cases {
+		name, argument, ok := enclosingCall(scanTokens(c.text))
+		if name != c.name || argument != c.argument || ok != c.ok {
+			t.Errorf("%q: expected %s, %d, %v, got %s, %d, %v", c.text, c.name, c.argument, c.ok, name, argument, ok)
+		}
+	}
+}
+
+func TestSignatureHelp(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, "// | lerp(1, 2, 0.5) + nope(1")
+	offsets := lsproto.WithClientCapabilities(t.Context(), &lsproto.ResolvedClientCapabilities{
+		TextDocument: lsproto.ResolvedTextDocumentClientCapabilities{
+			SignatureHelp: lsproto.ResolvedSignatureHelpClientCapabilities{
+				SignatureInformation: lsproto.ResolvedClientSignatureInformationOptions{
+					ParameterInformation: lsproto.ResolvedClientSignatureParameterInformationOptions{LabelOffsetSupport: true},
+				},
+			},
+		},
+	})
+
+	response, err := e.handleSignatureHelp(offsets, &lsproto.SignatureHelpParams{TextDocument: textDocument(), Position: position(0, 13)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	help := response.SignatureHelp
+	if help == nil || *help.ActiveParameter.Uinteger != 1 {
+		t.Fatalf("expected the second parameter of lerp to be active, got %+v", help)
+	}
+	signature := help.Signatures[0]
+	if signature.Label != "lerp(v0, v1, t)" {
+		t.Errorf("expected the signature of lerp, got %q", signature.Label)
+	}
+	for i, expected := range [][2]uint32{{5, 7}, {9, 11}, {13, 14}} {
+		label := (*signature.Parameters)[i].Label
+		if label.Tuple == nil || *label.Tuple != expected {
+			t.Errorf("parameter %d: expected offsets %v, got %+v", i, expected, label)
+		}
+	}
+
+	// Without offsets the parameters are labelled by name.
+	response, err = e.handleSignatureHelp(t.Context(), &lsproto.SignatureHelpParams{TextDocument: textDocument(), Position: position(0, 13)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := (*response.SignatureHelp.Signatures[0].Parameters)[2].Label; label.String == nil || *label.String != "t" {
+		t.Errorf("expected the parameter t by name, got %+v", label)
+	}
+
+	for _, character := range []uint32{2, 22, 30} {
+		response, err := e.handleSignatureHelp(t.Context(), &lsproto.SignatureHelpParams{TextDocument: textDocument(), Position: position(0, character)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.SignatureHelp != nil {
+			t.Errorf("%d: expected no signature help, got %s", character, response.SignatureHelp.Signatures[0].Label)
+		}
+	}
+}
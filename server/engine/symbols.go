@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/utils"
+	"strings"
+	"unicode/utf8"
+)
+
+// Pipe lines on consecutive lines of a document, a block of calculations in a comment.
+type pipeBlock []*interpreter.Interpretation
+
+func (b pipeBlock) firstLine() int {
+	return b[0].LineIndex
+}
+
+func (b pipeBlock) lastLine() int {
+	return b[len(b)-1].LineIndex
+}
+
+func (b pipeBlock) name() string {
+	if b.firstLine() == b.lastLine() {
+		return fmt.Sprintf("Line %d", b.firstLine()+1)
+	}
+	return fmt.Sprintf("Lines %d-%d", b.firstLine()+1, b.lastLine()+1)
+}
+
+// From the start of the first line to the end of the last pipe line.
+func (b pipeBlock) textRange() lsproto.Range {
+	last := b[len(b)-1]
+	return lsproto.Range{
+		Start: lsproto.Position{Line: uint32(b.firstLine()), Character: 0},
+		End:   lsproto.Position{Line: uint32(last.LineIndex), Character: uint32(last.Column + len(last.Text))},
+	}
+}
+
+// Splits the pipe lines of a document into blocks of consecutive lines.
+func pipeBlocks(doc *document) []pipeBlock {
+	blocks := []pipeBlock{}
+	for _, interpretation := range doc.interpretations {
+		n := len(blocks)
+		if n > 0 && blocks[n-1].lastLine() == interpretation.LineIndex-1 {
+			blocks[n-1] = append(blocks[n-1], interpretation)
+			continue
+		}
+		blocks = append(blocks, pipeBlock{interpretation})
+	}
+	return blocks
+}
+
+// The whole text of a pipe line, everything after the pipe.
+func pipeLineRange(interpretation *interpreter.Interpretation) lsproto.Range {
+	return lineRange(interpretation, 0, len(interpretation.Text))
+}
+
+func (e *Engine) handleFoldingRange(ctx context.Context, params *lsproto.FoldingRangeParams, _ *lsproto.RequestMessage) (lsproto.FoldingRangeResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.FoldingRangeResponse{}, nil
+	}
+
+	ranges := []*lsproto.FoldingRange{}
+	for _, block := range pipeBlocks(doc) {
+		if len(block) < 2 {
+			continue
+		}
+		ranges = append(ranges, &lsproto.FoldingRange{
+			StartLine: uint32(block.firstLine()),
+			EndLine:   uint32(block.lastLine()),
+			Kind:      utils.PointerTo(lsproto.FoldingRangeKindRegion),
+			// Folded blocks show what they add up to, the result of their last line.
+			CollapsedText: utils.PointerTo(fmt.Sprintf("%s = %s", block.name(), block[len(block)-1].EvalResult)),
+		})
+	}
+	return lsproto.FoldingRangeResponse{FoldingRanges: &ranges}, nil
+}
+
+// Lists every block with the variables assigned and the accumulation commands in it.
+//
+// Clients without hierarchical symbols get a flat list where each symbol names its block
+// as the container.
+func (e *Engine) handleDocumentSymbol(ctx context.Context, params *lsproto.DocumentSymbolParams, _ *lsproto.RequestMessage) (lsproto.DocumentSymbolResponse, error) {
+	doc := e.getDocument(params.TextDocument.Uri)
+	if doc == nil {
+		return lsproto.DocumentSymbolResponse{}, nil
+	}
+
+	if !lsproto.GetClientCapabilities(ctx).TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport {
+		symbols := []*lsproto.SymbolInformation{}
+		for _, block := range pipeBlocks(doc) {
+			symbols = append(symbols, blockSymbolInformation(doc.uri, block)...)
+		}
+		return lsproto.DocumentSymbolResponse{SymbolInformations: &symbols}, nil
+	}
+
+	symbols := []*lsproto.DocumentSymbol{}
+	for _, block := range pipeBlocks(doc) {
+		children := blockSymbols(block)
+		symbols = append(symbols, &lsproto.DocumentSymbol{
+			Name:           block.name(),
+			Kind:           lsproto.SymbolKindNamespace,
+			Range:          block.textRange(),
+			SelectionRange: pipeLineRange(block[0]),
+			Children:       &children,
+		})
+	}
+	return lsproto.DocumentSymbolResponse{DocumentSymbols: &symbols}, nil
+}
+
+// The assignments and accumulation commands of a block, in the order they appear.
+func blockSymbols(block pipeBlock) []*lsproto.DocumentSymbol {
+	symbols := []*lsproto.DocumentSymbol{}
+	for _, interpretation := range block {
+		if command := strings.TrimSpace(interpretation.Text); interpreter.IsAccumulationCommand(command) {
+			symbols = append(symbols, &lsproto.DocumentSymbol{
+				Name:           command,
+				Detail:         utils.PointerTo(interpretation.EvalResult),
+				Kind:           lsproto.SymbolKindOperator,
+				Range:          pipeLineRange(interpretation),
+				SelectionRange: pipeLineRange(interpretation),
+			})
+			continue
+		}
+		for _, binding := range interpretation.Bindings {
+			if !binding.Assigned {
+				continue
+			}
+			detail := "no value"
+			if binding.Value != nil {
+				detail = binding.Value.Inspect()
+				if name, family := boxUnit(binding.Value); name != "" {
+					detail = fmt.Sprintf("%s (%s)", detail, family)
+				}
+			}
+			symbols = append(symbols, &lsproto.DocumentSymbol{
+				Name:           binding.Name,
+				Detail:         utils.PointerTo(detail),
+				Kind:           lsproto.SymbolKindVariable,
+				Range:          pipeLineRange(interpretation),
+				SelectionRange: interpretation.BindingRange(binding),
+			})
+		}
+	}
+	return symbols
+}
+
+func blockSymbolInformation(uri lsproto.DocumentUri, block pipeBlock) []*lsproto.SymbolInformation {
+	symbols := []*lsproto.SymbolInformation{}
+	for _, symbol := range blockSymbols(block) {
+		symbols = append(symbols, &lsproto.SymbolInformation{
+			Name:          symbol.Name,
+			Kind:          symbol.Kind,
+			ContainerName: utils.PointerTo(block.name()),
+			Location:      lsproto.Location{Uri: uri, Range: symbol.SelectionRange},
+		})
+	}
+	return symbols
+}
+
+// Searches the variables assigned in every open document.
+func (e *Engine) handleWorkspaceSymbol(ctx context.Context, params *lsproto.WorkspaceSymbolParams, _ *lsproto.RequestMessage) (lsproto.WorkspaceSymbolResponse, error) {
+	symbols := []*lsproto.SymbolInformation{}
+	for _, doc := range e.documents.all() {
+		for _, block := range pipeBlocks(doc) {
+			for _, symbol := range blockSymbolInformation(doc.uri, block) {
+				if symbol.Kind == lsproto.SymbolKindVariable && matchesQuery(symbol.Name, params.Query) {
+					symbols = append(symbols, symbol)
+				}
+			}
+		}
+	}
+	return lsproto.WorkspaceSymbolResponse{SymbolInformations: &symbols}, nil
+}
+
+// Reports whether the characters of query appear in name in the same order, ignoring
+// case, so that `tl` finds `totalLength`. An empty query matches everything.
+func matchesQuery(name string, query string) bool {
+	rest := strings.ToLower(name)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(rest, r)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+utf8.RuneLen(r):]
+	}
+	return true
+}
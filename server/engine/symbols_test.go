@@ -0,0 +1,102 @@
+package engine
+
+import (
+	lsproto "puter/lsp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var symbolsText = strings.Join([]string{
+	"// | rent = 1200 usd",
+	"// | food = 300 usd",
+	"// | sum",
+	"text",
+	"// | totalLength = 3 km",
+}, "\n")
+
+func TestFoldingRanges(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, symbolsText)
+	response, err := e.handleFoldingRange(t.Context(), &lsproto.FoldingRangeParams{TextDocument: textDocument()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A single pipe line has nothing to fold.
+	ranges := *response.FoldingRanges
+	if len(ranges) != 1 {
+		t.Fatalf("expected 1 folding range, got %d", len(ranges))
+	}
+	if ranges[0].StartLine != 0 || ranges[0].EndLine != 2 || *ranges[0].CollapsedText != "Lines 1-3 = 1500 usd" {
+		t.Errorf("expected lines 0 to 2 folded to their sum, got %d-%d %q", ranges[0].StartLine, ranges[0].EndLine, *ranges[0].CollapsedText)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, symbolsText)
+	hierarchical := lsproto.WithClientCapabilities(t.Context(), &lsproto.ResolvedClientCapabilities{
+		TextDocument: lsproto.ResolvedTextDocumentClientCapabilities{
+			DocumentSymbol: lsproto.ResolvedDocumentSymbolClientCapabilities{HierarchicalDocumentSymbolSupport: true},
+		},
+	})
+
+	response, err := e.handleDocumentSymbol(hierarchical, &lsproto.DocumentSymbolParams{TextDocument: textDocument()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, block := range *response.DocumentSymbols {
+		got = append(got, block.Name)
+		for _, child := range *block.Children {
+			got = append(got, "  "+child.Name+": "+*child.Detail)
+		}
+	}
+	expected := []string{
+		"Lines 1-3",
+		"  rent: 1200 usd (currency)",
+		"  food: 300 usd (currency)",
+		"  sum: 1500 usd",
+		"Line 5",
+		"  totalLength: 3 kilometers (length)",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	response, err = e.handleDocumentSymbol(t.Context(), &lsproto.DocumentSymbolParams{TextDocument: textDocument()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat := *response.SymbolInformations
+	if len(flat) != 4 || flat[0].Name != "rent" || *flat[0].ContainerName != "Lines 1-3" || *flat[3].ContainerName != "Line 5" {
+		t.Errorf("expected a flat list of the 4 symbols in their blocks, got %d", len(flat))
+	}
+	if expected := (lsproto.Range{Start: position(0, 5), End: position(0, 9)}); flat[0].Location.Range != expected {
+		t.Errorf("expected rent at %v, got %v", expected, flat[0].Location.Range)
+	}
+}
+
+func TestWorkspaceSymbols(t *testing.T) {
+	e := newTestEngine(t)
+	openTestDocument(e, symbolsText)
+	cases := map[string][]string{
+		"":    {"rent", "food", "totalLength"},
+		"tl":  {"totalLength"},
+		"RNT": {"rent"},
+		"sum": {},
+	}
+	for query, expected := range cases {
+		response, err := e.handleWorkspaceSymbol(t.Context(), &lsproto.WorkspaceSymbolParams{Query: query}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, symbol := range *response.SymbolInformations {
+			names = append(names, symbol.Name)
+		}
+		if !slices.Equal(names, expected) {
+			t.Errorf("%q: expected %v, got %v", query, expected, names)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package evaluator
+
+import (
+	b "puter/evaluation/evaluator/box"
+)
+
+// An identifier that was read or assigned while evaluating a line.
+//
+// Positions are relative to the evaluated text, same as diagnostics.
+type Binding struct {
+	Name     string
+	StartPos int
+	EndPos   int
+	// The value the identifier resolved to. Nil if it was not found in the heap
+	// or if the right-hand side of an assignment failed to evaluate.
+	Value b.Box
+	// True if this is the left-hand side of an assignment, x in `x = 2 usd`.
+	Assigned bool
+}
+
+// A single `in` conversion performed while evaluating a line.
+//
+// `2 usd in thb in usd` records two conversions, usd -> thb then thb -> usd.
+type Conversion struct {
+	From b.Box
+	To   b.Box
+}
+
+// A comparison evaluated while evaluating a line, `x < 5 kg` records the value of x,
+// `<` and 5 kg.
+type Comparison struct {
+	Left     b.Box
+	Operator string
+	Right    b.Box
+	Result   bool
+}
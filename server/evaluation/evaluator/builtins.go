@@ -1,34 +1,92 @@
 package evaluator
 
 import (
+	"fmt"
 	"math"
 	b "puter/evaluation/evaluator/box"
+	"strings"
 )
 
-type builtinDef struct {
-	expectedArgs int
-	fn           func(args []b.NumericType) float64
+// Box types that carry a number, every one of them implements b.NumericType.
+var numericBoxTypes = []b.BoxType{b.NUMBER_BOX, b.PERCENT_BOX, b.CURRENCY_BOX, b.FIXED_UNIT_BOX}
+
+type BuiltinParam struct {
+	Name        string
+	Description string
+	// Box types an argument for this parameter can evaluate to.
+	Accepts []b.BoxType
+}
+
+type Builtin struct {
+	Description string
+	Params      []BuiltinParam
+	fn          func(args []b.NumericType) float64
+}
+
+// Signature of the builtin as it would be called, `lerp(v0, v1, t)`.
+func (builtin Builtin) Signature(name string) string {
+	names := []string{}
+	for _, param := range builtin.Params {
+		names = append(names, param.Name)
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(names, ", "))
+}
+
+func numeric(name string, description string) BuiltinParam {
+	return BuiltinParam{Name: name, Description: description, Accepts: numericBoxTypes}
+}
+
+// Shorthand for the many builtins that apply a math function to a single number.
+func unary(description string, fn func(float64) float64) Builtin {
+	return Builtin{
+		Description: description,
+		Params:      []BuiltinParam{numeric("x", "the number")},
+		fn:          func(a []b.NumericType) float64 { return fn(a[0].GetNumber()) },
+	}
 }
 
-var Builtins = map[string]builtinDef{
-	"mod":   {2, func(a []b.NumericType) float64 { return math.Mod(a[0].GetNumber(), a[1].GetNumber()) }},
-	"log10": {1, func(a []b.NumericType) float64 { return math.Log10(a[0].GetNumber()) }},
-	"logE":  {1, func(a []b.NumericType) float64 { return math.Log(a[0].GetNumber()) }},
-	"log2":  {1, func(a []b.NumericType) float64 { return math.Log2(a[0].GetNumber()) }},
-	"round": {1, func(a []b.NumericType) float64 { return math.Round(a[0].GetNumber()) }},
-	"floor": {1, func(a []b.NumericType) float64 { return math.Floor(a[0].GetNumber()) }},
-	"ceil":  {1, func(a []b.NumericType) float64 { return math.Ceil(a[0].GetNumber()) }},
-	"abs":   {1, func(a []b.NumericType) float64 { return math.Abs(a[0].GetNumber()) }},
-	"sin":   {1, func(a []b.NumericType) float64 { return math.Sin(a[0].GetNumber()) }},
-	"cos":   {1, func(a []b.NumericType) float64 { return math.Cos(a[0].GetNumber()) }},
-	"tan":   {1, func(a []b.NumericType) float64 { return math.Tan(a[0].GetNumber()) }},
-	"sqrt":  {1, func(a []b.NumericType) float64 { return math.Sqrt(a[0].GetNumber()) }},
-	"lerp": {3, func(a []b.NumericType) float64 {
-		v0, v1, t := a[0].GetNumber(), a[1].GetNumber(), a[2].GetNumber()
-		return (1-t)*v0 + t*v1
-	}},
-	"invLerp": {3, func(a []b.NumericType) float64 {
-		v0, v1, v := a[0].GetNumber(), a[1].GetNumber(), a[2].GetNumber()
-		return (v - v0) / (v1 - v0)
-	}},
+var Builtins = map[string]Builtin{
+	"mod": {
+		Description: "Remainder of dividing x by y, with the sign of x.",
+		Params: []BuiltinParam{
+			numeric("x", "the dividend"),
+			numeric("y", "the divisor"),
+		},
+		fn: func(a []b.NumericType) float64 { return math.Mod(a[0].GetNumber(), a[1].GetNumber()) },
+	},
+	"log10": unary("Base 10 logarithm of x.", math.Log10),
+	"logE":  unary("Natural logarithm of x.", math.Log),
+	"log2":  unary("Base 2 logarithm of x.", math.Log2),
+	"round": unary("x rounded to the nearest integer, half away from zero.", math.Round),
+	"floor": unary("The greatest integer less than or equal to x.", math.Floor),
+	"ceil":  unary("The least integer greater than or equal to x.", math.Ceil),
+	"abs":   unary("Absolute value of x.", math.Abs),
+	"sin":   unary("Sine of x radians.", math.Sin),
+	"cos":   unary("Cosine of x radians.", math.Cos),
+	"tan":   unary("Tangent of x radians.", math.Tan),
+	"sqrt":  unary("Square root of x.", math.Sqrt),
+	"lerp": {
+		Description: "Linear interpolation between v0 and v1, v0 when t is 0 and v1 when t is 1.",
+		Params: []BuiltinParam{
+			numeric("v0", "the value at t = 0"),
+			numeric("v1", "the value at t = 1"),
+			numeric("t", "how far to go from v0 to v1"),
+		},
+		fn: func(a []b.NumericType) float64 {
+			v0, v1, t := a[0].GetNumber(), a[1].GetNumber(), a[2].GetNumber()
+			return (1-t)*v0 + t*v1
+		},
+	},
+	"invLerp": {
+		Description: "Inverse of lerp, how far v is from v0 to v1, 0 at v0 and 1 at v1.",
+		Params: []BuiltinParam{
+			numeric("v0", "the value at 0"),
+			numeric("v1", "the value at 1"),
+			numeric("v", "the value in between"),
+		},
+		fn: func(a []b.NumericType) float64 {
+			v0, v1, v := a[0].GetNumber(), a[1].GetNumber(), a[2].GetNumber()
+			return (v - v0) / (v1 - v0)
+		},
+	},
 }
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"puter/evaluation/ast"
 	b "puter/evaluation/evaluator/box"
 	p "puter/evaluation/parser"
 	"puter/unit"
+	"slices"
 )
 
 type Evaluator struct {
@@ -28,6 +30,12 @@ type Evaluator struct {
 	//
 	// There is also the fact that evaluations are line-by-line here so error here does not mean the entire program halts.
 	diagnostics []*ast.Diagnostic
+	// Identifiers read or assigned by the last evaluated line.
+	bindings []*Binding
+	// Conversions performed by the last evaluated line, in evaluation order.
+	conversions []*Conversion
+	// Comparisons performed by the last evaluated line, in evaluation order.
+	comparisons []*Comparison
 }
 
 func NewEvaluator(ctx context.Context, converters *unit.Converters) *Evaluator {
@@ -53,6 +61,9 @@ func makeDefaultHeap() map[string]b.Box {
 // The returned b.Box is nullable if an error is encountered during evaluation
 func (e *Evaluator) EvalLine(text string) b.Box {
 	e.diagnostics = []*ast.Diagnostic{}
+	e.bindings = []*Binding{}
+	e.conversions = []*Conversion{}
+	e.comparisons = []*Comparison{}
 	expression, err := e.parser.Parse(text)
 	if err != nil {
 		e.diagnostics = append(e.diagnostics, err)
@@ -69,6 +80,13 @@ func (e *Evaluator) evalExp(expression ast.Expression) b.Box {
 		ident, ok := exp.Name.(*ast.IdentExpression)
 		if ok {
 			e.heap[ident.ActualValue] = value
+			e.bindings = append(e.bindings, &Binding{
+				Name:     ident.ActualValue,
+				StartPos: ident.Token().StartPos(),
+				EndPos:   ident.Token().EndPos(),
+				Value:    value,
+				Assigned: true,
+			})
 			return value
 
 		}
@@ -231,6 +249,12 @@ func (e *Evaluator) evalExp(expression ast.Expression) b.Box {
 		}
 	case *ast.IdentExpression:
 		found, ok := e.heap[exp.ActualValue]
+		e.bindings = append(e.bindings, &Binding{
+			Name:     exp.ActualValue,
+			StartPos: exp.Token().StartPos(),
+			EndPos:   exp.Token().EndPos(),
+			Value:    found,
+		})
 		if !ok {
 			e.diagnostics = append(e.diagnostics, ast.NewDiagnosticAtToken(
 				fmt.Sprintf("Identifier %s not found", exp.ActualValue),
@@ -271,6 +295,8 @@ func (e *Evaluator) evalInExpression(leftExpr ast.Expression, rightExpr ast.Expr
 				leftExpr.Token().StartPos(),
 				right.Token().EndPos(),
 			))
+		} else if res != nil {
+			e.conversions = append(e.conversions, &Conversion{From: leftBox, To: res})
 		}
 		return res
 	}
@@ -310,6 +336,8 @@ func (e *Evaluator) evalBinaryBooleanComparisonExpression(leftExpr ast.Expressio
 				leftExpr.Token().StartPos(),
 				rightExpr.Token().EndPos(),
 			))
+		} else if result, ok := res.(*b.BooleanBox); ok {
+			e.comparisons = append(e.comparisons, &Comparison{Left: leftBox, Operator: operator.Literal, Right: rightBox, Result: result.Value})
 		}
 		return res
 	}
@@ -323,8 +351,11 @@ func (e *Evaluator) evalCallExpression(functionName ast.Expression, arguments []
 		return nil
 	}
 
-	if builtin.expectedArgs != len(arguments) {
-		text := fmt.Sprintf("Expected %d arguments, got %d len(arguments)", builtin.expectedArgs, len(arguments))
+	if len(builtin.Params) != len(arguments) {
+		text := fmt.Sprintf(
+			"%s expects %d arguments, got %d",
+			builtin.Signature(functionName.String()), len(builtin.Params), len(arguments),
+		)
 		e.diagnostics = append(
 			e.diagnostics,
 			ast.NewDiagnosticAtToken(text, functionName.Token()),
@@ -333,11 +364,13 @@ func (e *Evaluator) evalCallExpression(functionName ast.Expression, arguments []
 	}
 
 	var parsedArgs []b.NumericType
-	for _, arg := range arguments {
-		eval, ok := e.evalExp(arg).(b.NumericType)
-		if !ok {
+	for i, arg := range arguments {
+		param := builtin.Params[i]
+		value := e.evalExp(arg)
+		eval, ok := value.(b.NumericType)
+		if !ok || !slices.Contains(param.Accepts, value.Type()) {
 			e.diagnostics = append(e.diagnostics, ast.NewDiagnosticAtToken(
-				"Expect a number type",
+				fmt.Sprintf("Expect a number type for %s", param.Name),
 				arg.Token(),
 			))
 			return nil
@@ -354,6 +387,10 @@ func (e *Evaluator) evalCallExpression(functionName ast.Expression, arguments []
 func (e *Evaluator) evalBinaryNumberExpression(left ast.Expression, right ast.Expression, operator *ast.Token, operation func(a, b float64) float64) b.Box {
 	var boxLeft b.Box = e.evalExp(left)
 	var boxRight b.Box = e.evalExp(right)
+	if boxRight == nil {
+		// the right-hand side already reported why it could not be evaluated.
+		return nil
+	}
 	if operatable, ok := boxLeft.(b.BinaryNumberOperatable); !ok {
 		e.diagnostics = append(e.diagnostics, ast.NewDiagnostic(
 			"Left hand side of this expression is not evaluable by this operator",
@@ -377,3 +414,31 @@ func (e *Evaluator) evalBinaryNumberExpression(left ast.Expression, right ast.Ex
 func (e *Evaluator) GetDiagnostics() []*ast.Diagnostic {
 	return e.diagnostics
 }
+
+func (e *Evaluator) GetBindings() []*Binding {
+	return e.bindings
+}
+
+func (e *Evaluator) GetConversions() []*Conversion {
+	return e.conversions
+}
+
+func (e *Evaluator) GetComparisons() []*Comparison {
+	return e.comparisons
+}
+
+// Makes `^` raise to a power instead of being a bitwise xor.
+func (e *Evaluator) SetCaretIsExponent(caretIsExponent bool) {
+	e.parser.SetCaretIsExponent(caretIsExponent)
+}
+
+// Sets a variable as if it had been assigned by an evaluated line. Used to restore
+// the heap from lines whose evaluation is cached instead of evaluating them again.
+func (e *Evaluator) SetVariable(name string, value b.Box) {
+	e.heap[name] = value
+}
+
+// Returns a copy of the variables assigned so far, including the default ones like pi.
+func (e *Evaluator) Variables() map[string]b.Box {
+	return maps.Clone(e.heap)
+}
@@ -540,6 +540,41 @@ func TestBuiltinFunctionEvaluations(t *testing.T) {
 	}
 }
 
+func TestBuiltinArgumentErrors(t *testing.T) {
+	cases := []struct {
+		Line          string
+		ExpectMessage string
+	}{
+		{"lerp(0, 10)", "lerp(v0, v1, t) expects 3 arguments, got 2"},
+		{"sqrt(1, 2)", "sqrt(x) expects 1 arguments, got 2"},
+		{"mod(10, true)", "Expect a number type for y"},
+	}
+	for _, c := range cases {
+		eval := NewEvaluator(t.Context(), getDefaultConverters(200))
+
+		if obj := eval.EvalLine(c.Line); obj != nil {
+			t.Fatalf("Expected no result for %s, got %s", c.Line, obj.Inspect())
+		}
+		if len(eval.diagnostics) != 1 || eval.diagnostics[0].Message != c.ExpectMessage {
+			t.Fatalf("Expected diagnostic %q for %s, got %+v", c.ExpectMessage, c.Line, eval.diagnostics)
+		}
+	}
+}
+
+func TestUnevaluableRightHandSide(t *testing.T) {
+	// The right-hand side reports why it can't be evaluated, the operator adds nothing.
+	for _, line := range []string{"2 + foo", "3 km * foo", "20 usd - foo", "10% + foo"} {
+		eval := NewEvaluator(t.Context(), getDefaultConverters(200))
+
+		if obj := eval.EvalLine(line); obj != nil {
+			t.Fatalf("Expected no result for %s, got %s", line, obj.Inspect())
+		}
+		if len(eval.diagnostics) != 1 || eval.diagnostics[0].Message != "Identifier foo not found" {
+			t.Fatalf("Expected only the unknown identifier for %s, got %+v", line, eval.diagnostics)
+		}
+	}
+}
+
 func TestDefaultHeap(t *testing.T) {
 	eval := NewEvaluator(t.Context(), getDefaultConverters(200))
 	eResult := eval.EvalLine("e")
@@ -551,3 +586,69 @@ func TestDefaultHeap(t *testing.T) {
 		t.Fatalf("pi is null")
 	}
 }
+
+func TestBindings(t *testing.T) {
+	eval := NewEvaluator(t.Context(), getDefaultConverters(200))
+	eval.EvalLine("a = 2 usd")
+	eval.EvalLine("b = a + c")
+
+	bindings := eval.GetBindings()
+	if len(bindings) != 3 {
+		t.Fatalf("Expected 3 bindings, got %d", len(bindings))
+	}
+
+	// the right-hand side is evaluated before the assignment is recorded
+	a, c, assigned := bindings[0], bindings[1], bindings[2]
+	if a.Name != "a" || a.Assigned || a.Value.Inspect() != "2 usd" {
+		t.Fatalf("Expected a to be read as 2 usd, got %+v", a)
+	}
+	if a.StartPos != 4 || a.EndPos != 5 {
+		t.Fatalf("Expected a at 4-5, got %d-%d", a.StartPos, a.EndPos)
+	}
+	if c.Name != "c" || c.Value != nil {
+		t.Fatalf("Expected c to be unresolved, got %+v", c)
+	}
+	if assigned.Name != "b" || !assigned.Assigned {
+		t.Fatalf("Expected b to be assigned, got %+v", assigned)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	eval := NewEvaluator(t.Context(), getDefaultConverters(200))
+	eval.EvalLine("1000 m in km in cm")
+
+	conversions := eval.GetConversions()
+	if len(conversions) != 3 {
+		t.Fatalf("Expected 3 conversions, got %d", len(conversions))
+	}
+	expected := [][2]string{
+		{"1000", "1000 meters"},
+		{"1000 meters", "1 kilometers"},
+		{"1 kilometers", "100000 centimeters"},
+	}
+	for i, conversion := range conversions {
+		if conversion.From.Inspect() != expected[i][0] || conversion.To.Inspect() != expected[i][1] {
+			t.Fatalf("Expected conversion %s -> %s, got %s -> %s", expected[i][0], expected[i][1], conversion.From.Inspect(), conversion.To.Inspect())
+		}
+	}
+
+	eval.EvalLine("1 + 1")
+	if len(eval.GetConversions()) != 0 {
+		t.Fatalf("Expected conversions to be reset between lines")
+	}
+}
+
+func TestCaretAsExponent(t *testing.T) {
+	eval := NewEvaluator(t.Context(), getDefaultConverters(200))
+	if result := eval.EvalLine("2 * 3 ^ 2"); result.Inspect() != "4" {
+		t.Fatalf("Expected ^ to be xor by default, got %s", result.Inspect())
+	}
+
+	eval.SetCaretIsExponent(true)
+	if result := eval.EvalLine("2 * 3 ^ 2"); result.Inspect() != "18" {
+		t.Fatalf("Expected ^ to bind like **, got %s", result.Inspect())
+	}
+	if result := eval.EvalLine("2 ^ 3 ^ 2"); result.Inspect() != "512" {
+		t.Fatalf("Expected ^ to be right associative, got %s", result.Inspect())
+	}
+}
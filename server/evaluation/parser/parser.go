@@ -65,6 +65,11 @@ func NewParser() *Parser {
 	return parser
 }
 
+// Makes `^` raise to a power with the precedence of `**`, instead of being a bitwise xor.
+func (p *Parser) SetCaretIsExponent(caretIsExponent bool) {
+	p.scanner.SetCaretIsExponent(caretIsExponent)
+}
+
 func (p *Parser) Parse(text string) (ast.Expression, *ast.Diagnostic) {
 	p.scanner.SetState(0, text)
 	return p.parseExpression(0)
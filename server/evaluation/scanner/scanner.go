@@ -7,6 +7,8 @@ import (
 type Scanner struct {
 	pos  int
 	text string
+	// Whether `^` scans as `**` instead of xor.
+	caretIsExponent bool
 }
 
 func NewScanner(text string) *Scanner {
@@ -21,6 +23,11 @@ func (s *Scanner) SetState(pos int, text string) {
 	s.text = text
 }
 
+// Makes `^` raise to a power, like `**`, instead of being a bitwise xor.
+func (s *Scanner) SetCaretIsExponent(caretIsExponent bool) {
+	s.caretIsExponent = caretIsExponent
+}
+
 func (s *Scanner) Next() *ast.Token {
 	s.skipWhitespace()
 
@@ -111,7 +118,11 @@ func (s *Scanner) Next() *ast.Token {
 		token = ast.NewToken(ast.NOT, string(s.ch(0)), s.pos)
 		s.pos++
 	case '^':
-		token = ast.NewToken(ast.XOR, string(s.ch(0)), s.pos)
+		if s.caretIsExponent {
+			token = ast.NewToken(ast.DOUBLE_ASTERISK, string(s.ch(0)), s.pos)
+		} else {
+			token = ast.NewToken(ast.XOR, string(s.ch(0)), s.pos)
+		}
 		s.pos++
 	case '%':
 		token = ast.NewToken(ast.PERCENT, string(s.ch(0)), s.pos)
@@ -116,3 +116,18 @@ func TestLogicalOperators(t *testing.T) {
 		}
 	}
 }
+
+func TestCaretAsExponent(t *testing.T) {
+	scanner := NewScanner("2 ^ 3")
+	scanner.Next()
+	if r := scanner.Next(); r.Type != ast.XOR {
+		t.Fatalf("Expected %s, got %s", ast.XOR, r.Type)
+	}
+
+	scanner = NewScanner("2 ^ 3")
+	scanner.SetCaretIsExponent(true)
+	scanner.Next()
+	if r := scanner.Next(); r.Type != ast.DOUBLE_ASTERISK || r.Literal != "^" {
+		t.Fatalf("Expected %s with literal ^, got %s %s", ast.DOUBLE_ASTERISK, r.Type, r.Literal)
+	}
+}
@@ -3,6 +3,9 @@ module puter
 require (
 	github.com/go-json-experiment/json v0.0.0-20251027170946-4849db3c2f7e
 	golang.org/x/sync v0.19.0
+	golang.org/x/term v0.37.0
 )
 
+require golang.org/x/sys v0.38.0 // indirect
+
 go 1.25.0
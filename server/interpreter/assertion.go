@@ -0,0 +1,93 @@
+package interpreter
+
+import (
+	"fmt"
+	"puter/evaluation/evaluator"
+	"puter/evaluation/evaluator/box"
+	lsproto "puter/lsp"
+	"puter/utils"
+	"strings"
+)
+
+// A pipe line is an assertion when it starts with the keyword, `// | assert x < 5 kg`,
+// or ends with the question mark, `// | total == 1200 usd ?`.
+const (
+	AssertKeyword  = "assert"
+	assertQuestion = "?"
+)
+
+// The code of the diagnostic of an assertion that failed.
+const AssertionFailedCode = "assertion"
+
+// The outcome of a pipe line that is an assertion.
+type Assertion struct {
+	Passed bool
+	// The comparison that failed, or the last one evaluated when the assertion passed.
+	// Nil for an assertion without a comparison, like `assert done`.
+	Comparison *evaluator.Comparison
+}
+
+// Returns the expression of an assertion, with the keyword and the question mark replaced
+// by spaces so that positions in the expression are positions in text. ok is false when
+// text is not an assertion.
+func assertionExpression(text string) (expression string, ok bool) {
+	expression = text
+	trimmed := strings.TrimRight(expression, " \t\r")
+	if strings.HasSuffix(trimmed, assertQuestion) {
+		expression = trimmed[:len(trimmed)-len(assertQuestion)] + " " + expression[len(trimmed):]
+		ok = true
+	}
+
+	start := len(expression) - len(strings.TrimLeft(expression, " \t"))
+	rest, isKeyword := strings.CutPrefix(expression[start:], AssertKeyword)
+	// `assert = 2` assigns a variable named assert.
+	afterKeyword := strings.TrimLeft(rest, " \t")
+	isAssignment := strings.HasPrefix(afterKeyword, "=") && !strings.HasPrefix(afterKeyword, "==")
+	if isKeyword && len(afterKeyword) < len(rest) && !isAssignment {
+		expression = expression[:start] + strings.Repeat(" ", len(AssertKeyword)) + rest
+		ok = true
+	}
+	return expression, ok
+}
+
+// Checks the result of an assertion that evaluated without diagnostics. Returns the
+// diagnostic to report when it did not pass.
+func checkAssertion(result box.Box, comparisons []*evaluator.Comparison, expression string, lineIndex int, column int, precision int) (*Assertion, *lsproto.Diagnostic) {
+	start := len(expression) - len(strings.TrimLeft(expression, " \t"))
+	end := len(strings.TrimRight(expression, " \t\r"))
+	diagnostic := &lsproto.Diagnostic{
+		Severity: utils.PointerTo(lsproto.DiagnosticSeverityError),
+		Range: lsproto.Range{
+			Start: lsproto.Position{Line: uint32(lineIndex), Character: uint32(column + start)},
+			End:   lsproto.Position{Line: uint32(lineIndex), Character: uint32(column + end)},
+		},
+		Source: utils.PointerTo("puter"),
+	}
+
+	passed, isBoolean := result.(*box.BooleanBox)
+	if !isBoolean {
+		diagnostic.Message = fmt.Sprintf("An assertion must be true or false, got %s", formatResult(result, precision))
+		return nil, diagnostic
+	}
+
+	assertion := &Assertion{Passed: passed.Value}
+	for _, comparison := range comparisons {
+		if passed.Value || !comparison.Result {
+			assertion.Comparison = comparison
+		}
+	}
+	if assertion.Passed {
+		return assertion, nil
+	}
+
+	diagnostic.Code = &lsproto.IntegerOrString{String: utils.PointerTo(AssertionFailedCode)}
+	diagnostic.Message = "Assertion failed"
+	if comparison := assertion.Comparison; comparison != nil {
+		expected := formatResult(comparison.Right, precision)
+		if comparison.Operator != "==" {
+			expected = comparison.Operator + " " + expected
+		}
+		diagnostic.Message = fmt.Sprintf("Assertion failed: expected %s, got %s", expected, formatResult(comparison.Left, precision))
+	}
+	return assertion, diagnostic
+}
@@ -0,0 +1,199 @@
+package interpreter
+
+import (
+	"context"
+	"puter/evaluation/evaluator"
+	lsproto "puter/lsp"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// A line starting with `//|` or `#|`, before it is evaluated.
+type pipeLine struct {
+	lineIndex int
+	column    int
+	text      string
+	suffix    string
+}
+
+// Returns the names of the variables this line reads, in order of appearance.
+func (in *Interpretation) Reads() []string {
+	return in.bindingNames(false)
+}
+
+// Returns the names of the variables this line assigns, in order of appearance.
+func (in *Interpretation) Writes() []string {
+	return in.bindingNames(true)
+}
+
+func (in *Interpretation) bindingNames(assigned bool) []string {
+	names := []string{}
+	for _, binding := range in.Bindings {
+		if binding.Assigned == assigned && !slices.Contains(names, binding.Name) {
+			names = append(names, binding.Name)
+		}
+	}
+	return names
+}
+
+// Evaluates the pipe lines of text, reusing the interpretations of a previous version
+// of the same document wherever an edit could not have changed them.
+//
+// Old and new pipe lines are lined up by their common prefix and suffix; everything
+// in between is what the edit touched and is always evaluated. Variables assigned in
+// that middle part are marked as changed, and a line further down is only evaluated
+// again when it reads a changed variable. Once a line assigns the same value as it
+// did before, the variable is no longer considered changed, so a local edit stops
+// propagating as soon as it stops making a difference.
+//
+// Passing nil for previous evaluates everything.
+func (interpreter *Interpreter) Reinterpret(previous []*Interpretation, text string) []*Interpretation {
+	interpretations, err := interpreter.ReinterpretContext(interpreter.ctx, previous, text)
+	if err != nil {
+		// Only happens once the interpreter itself is shutting down.
+		return []*Interpretation{}
+	}
+	return interpretations
+}
+
+// Same as Reinterpret, but stops between two lines as soon as ctx is done and returns
+// its error. Used to abandon the evaluation of a version that was already superseded.
+func (interpreter *Interpreter) ReinterpretContext(ctx context.Context, previous []*Interpretation, text string) ([]*Interpretation, error) {
+	return interpreter.ReinterpretLanguage(ctx, "", previous, text)
+}
+
+// Same as ReinterpretContext, for a document of the language with the LSP id languageId.
+// Its pipe lines start with the comment markers of that language.
+func (interpreter *Interpreter) ReinterpretLanguage(ctx context.Context, languageId string, previous []*Interpretation, text string) ([]*Interpretation, error) {
+	options := interpreter.Options()
+	evaluator := evaluator.NewEvaluator(ctx, interpreter.converters)
+	evaluator.SetCaretIsExponent(options.CaretIsExponent)
+	pipeLines := findPipeLines(text, options.commentMarkers(languageId), options.WrittenResults)
+
+	prefix := 0
+	for prefix < len(pipeLines) && prefix < len(previous) && sameLine(pipeLines[prefix], previous[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(pipeLines)-prefix && suffix < len(previous)-prefix &&
+		sameLine(pipeLines[len(pipeLines)-1-suffix], previous[len(previous)-1-suffix]) {
+		suffix++
+	}
+
+	changed := map[string]bool{}
+	interpretations := make([]*Interpretation, 0, len(pipeLines))
+	hasLineCommands := false
+	for i, line := range pipeLines {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i == prefix {
+			// Whatever the replaced lines assigned may now have a different value, or none.
+			for _, replaced := range previous[prefix : len(previous)-suffix] {
+				for _, name := range replaced.Writes() {
+					changed[name] = true
+				}
+			}
+		}
+
+		trimmed := strings.Trim(line.text, " ")
+		if IsAccumulationCommand(trimmed) {
+			// Accumulation results depend on every line above, they are recomputed below.
+			hasLineCommands = true
+			interpretations = append(interpretations, &Interpretation{
+				Text:        line.text,
+				LineIndex:   line.lineIndex,
+				Diagnostics: []*lsproto.Diagnostic{},
+				EvalResult:  trimmed,
+				Box:         nil,
+				Column:      line.column,
+				Suffix:      line.suffix,
+			})
+			continue
+		}
+
+		var before *Interpretation
+		switch {
+		case i < prefix:
+			before = previous[i]
+		case i >= len(pipeLines)-suffix:
+			before = previous[len(previous)-(len(pipeLines)-i)]
+		}
+
+		if before != nil && !before.readsAny(changed) {
+			for _, binding := range before.Bindings {
+				if binding.Assigned {
+					evaluator.SetVariable(binding.Name, binding.Value)
+					delete(changed, binding.Name)
+				}
+			}
+			interpretations = append(interpretations, before.movedTo(line.lineIndex))
+			continue
+		}
+
+		interpretation := interpreter.evaluateAndInterpretResult(evaluator, line.text, line.lineIndex, line.column, options.Precision)
+		interpretation.Suffix = line.suffix
+		for _, name := range interpretation.Writes() {
+			if before != nil && reflect.DeepEqual(before.written(name), interpretation.written(name)) {
+				delete(changed, name)
+			} else {
+				changed[name] = true
+			}
+		}
+		interpretations = append(interpretations, interpretation)
+	}
+
+	if hasLineCommands {
+		interpreter.handleLineAccumulationCommands(interpretations, options)
+	}
+
+	return interpretations, nil
+}
+
+func (in *Interpretation) readsAny(names map[string]bool) bool {
+	if len(names) == 0 {
+		return false
+	}
+	for _, binding := range in.Bindings {
+		if !binding.Assigned && names[binding.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether an interpretation was made from the same pipe line, regardless of
+// where in the document the line is.
+func sameLine(line pipeLine, interpretation *Interpretation) bool {
+	return line.text == interpretation.Text && line.column == interpretation.Column && line.suffix == interpretation.Suffix
+}
+
+// Returns the value the line leaves name with, the last value it assigned.
+func (in *Interpretation) written(name string) any {
+	var value any
+	for _, binding := range in.Bindings {
+		if binding.Assigned && binding.Name == name {
+			value = binding.Value
+		}
+	}
+	return value
+}
+
+// Returns the interpretation as if its line was at lineIndex. Interpretations are shared
+// between versions of a document, so a moved line gets a copy rather than being updated.
+func (in *Interpretation) movedTo(lineIndex int) *Interpretation {
+	if in.LineIndex == lineIndex {
+		return in
+	}
+	moved := *in
+	moved.LineIndex = lineIndex
+	moved.Diagnostics = make([]*lsproto.Diagnostic, len(in.Diagnostics))
+	for i, diagnostic := range in.Diagnostics {
+		d := *diagnostic
+		d.Range.Start.Line = uint32(lineIndex)
+		d.Range.End.Line = uint32(lineIndex)
+		moved.Diagnostics[i] = &d
+	}
+	return &moved
+}
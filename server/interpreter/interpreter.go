@@ -7,13 +7,14 @@ import (
 	lsproto "puter/lsp"
 	"puter/unit"
 	"puter/utils"
-	"slices"
 	"strings"
+	"sync/atomic"
 )
 
 type Interpreter struct {
 	ctx        context.Context
 	converters *unit.Converters
+	options    atomic.Pointer[Options]
 }
 
 type Interpretation struct {
@@ -21,6 +22,28 @@ type Interpretation struct {
 	LineIndex   int
 	EvalResult  string
 	Diagnostics []*lsproto.Diagnostic
+	// The text after the pipe that was evaluated.
+	Text string
+	// Character index within the line at which the evaluated text starts, right after the pipe.
+	// Positions reported by the evaluator are relative to this column.
+	Column int
+	// The end of the comment after the text, like `-->` for `<!-- | 1 + 2 -->`, up to the
+	// end of the line.
+	Suffix string
+	// Identifiers read or assigned on this line and the values they resolved to.
+	Bindings []*evaluator.Binding
+	// The `in` conversions that produced the result, in evaluation order.
+	Conversions []*evaluator.Conversion
+	// Set when the line is an assertion that could be evaluated.
+	Assertion *Assertion
+}
+
+// Returns the range a binding of this line covers in the document.
+func (in *Interpretation) BindingRange(binding *evaluator.Binding) lsproto.Range {
+	return lsproto.Range{
+		Start: lsproto.Position{Line: uint32(in.LineIndex), Character: uint32(in.Column + binding.StartPos)},
+		End:   lsproto.Position{Line: uint32(in.LineIndex), Character: uint32(in.Column + binding.EndPos)},
+	}
 }
 
 // Interpreter takes in a text file, finds out if there is a line in that text file
@@ -41,95 +64,87 @@ type Interpretation struct {
 // }
 // ```
 func NewInterpreter(ctx context.Context, converters *unit.Converters) *Interpreter {
-	return &Interpreter{
-		ctx,
-		converters,
+	interpreter := &Interpreter{
+		ctx:        ctx,
+		converters: converters,
 	}
+	interpreter.SetOptions(DefaultOptions())
+	return interpreter
 }
 
-// We do not yet need to care about the uri since we're doing full parsing
-func (interpreter *Interpreter) Interpret(text string) []*Interpretation {
-	evaluator := evaluator.NewEvaluator(interpreter.ctx, interpreter.converters)
+// Replaces the options used by every evaluation that starts afterwards. Interpretations
+// made with the old options are not updated, so they should not be passed to Reinterpret.
+func (interpreter *Interpreter) SetOptions(options Options) {
+	interpreter.options.Store(&options)
+}
 
-	interpretations := []*Interpretation{}
+func (interpreter *Interpreter) Options() Options {
+	return *interpreter.options.Load()
+}
 
-	hasLineCommands := false
+// Evaluates every pipe line of text from scratch.
+func (interpreter *Interpreter) Interpret(text string) []*Interpretation {
+	return interpreter.Reinterpret(nil, text)
+}
 
-	pos := 0
-	i := 0 // line index
-	lines := slices.Collect(strings.SplitSeq(text, "\n"))
-	for i < len(lines) {
+// Evaluates a single expression that is not part of a pipe line, with variables defined
+// on top of the default ones. Positions in the result are as if text started at column
+// of the line at lineIndex. Unlike a pipe line, text is never an assertion.
+func (interpreter *Interpreter) Evaluate(ctx context.Context, text string, variables map[string]box.Box, lineIndex int, column int) *Interpretation {
+	options := interpreter.Options()
+	evaluator := evaluator.NewEvaluator(ctx, interpreter.converters)
+	evaluator.SetCaretIsExponent(options.CaretIsExponent)
+	for name, value := range variables {
+		evaluator.SetVariable(name, value)
+	}
+	return interpretExpression(evaluator, text, lineIndex, column, options.Precision)
+}
 
-		if len(lines[i]) < 2 { // 2 is double slash, use this + "|" as minimum line length
-			pos += len(lines[i])
-			i++
+// Separates the expression of a pipe line from a result written after it, like
+// `// | 1 + 2  => 3`, see Options.WrittenResults.
+const ResultSeparator = "=>"
+
+// Finds the pipe lines of text, the lines starting with one of markers followed by a pipe.
+// With writtenResults, a result written after the expression is left out of it.
+func findPipeLines(text string, markers []string, writtenResults bool) []pipeLine {
+	pipeLines := []pipeLine{}
+	for i, line := range strings.Split(text, "\n") {
+		index, closing := pipeIndex(line, markers)
+		if index < 0 {
 			continue
 		}
-
-		firstThreeCharsNotSpace := func() string {
-			s := ""
-			for _, c := range lines[i] {
-				if len(s) == 3 {
-					return s
-				}
-				if c != ' ' {
-					s += string(c)
-				}
-			}
-			return s
-		}()
-
-		// python or c-like normal comment
-		validLineStart := func() bool {
-			if len(firstThreeCharsNotSpace) < 3 {
-				return false
-			}
-			return (firstThreeCharsNotSpace[0] == '#' && firstThreeCharsNotSpace[1] == '|') ||
-				(firstThreeCharsNotSpace[:2] == "//" && firstThreeCharsNotSpace[2] == '|')
-		}()
-		if validLineStart {
-			index := strings.Index(lines[i], "|")
-			evaluatable := lines[i][index+1:]
-			trimmed := strings.Trim(evaluatable, " ")
-			if IsAccumulationCommand(trimmed) {
-				hasLineCommands = true
-				interpretations = append(interpretations, &Interpretation{
-					LineIndex:   i,
-					Diagnostics: []*lsproto.Diagnostic{},
-					EvalResult:  trimmed,
-					Box:         nil,
-				})
-			} else {
-				interpretation := interpreter.evaluateAndInterpretResult(evaluator, evaluatable, i)
-				interpretations = append(interpretations, interpretation)
-			}
+		expression, suffix := line[index+1:], ""
+		if end := strings.LastIndex(expression, closing); closing != "" && end >= 0 {
+			expression, suffix = strings.TrimRight(expression[:end], " \t"), strings.TrimRight(expression[end:], " \t\r")
 		}
-
-		pos += len(text)
-		i++
-	}
-
-	if hasLineCommands {
-		interpreter.handleLineAccumulationCommands(interpretations)
+		if before, _, written := strings.Cut(expression, ResultSeparator); writtenResults && written {
+			expression = strings.TrimRight(before, " \t")
+		}
+		pipeLines = append(pipeLines, pipeLine{
+			lineIndex: i,
+			column:    index + 1,
+			text:      expression,
+			suffix:    suffix,
+		})
 	}
-
-	return interpretations
+	return pipeLines
 }
 
 // if there exist line command `sum` or `product`, iterate
 // backward until either command is found. Once found, start an accumulator and
 // sum or multiple everything above until line index is 0 or another command is found.
 // Then populate the interpretation with the new result.
-func (interpreter *Interpreter) handleLineAccumulationCommands(out []*Interpretation) {
+func (interpreter *Interpreter) handleLineAccumulationCommands(out []*Interpretation, options Options) {
 	var acc *LineAccumulator
 	for i := len(out) - 1; i >= 0; i-- {
 		text := out[i].EvalResult
 		// first time encountering accumulation keyword, initialize a new line accumulator
 		if IsAccumulationCommand(text) {
 			if acc != nil {
-				out[acc.GetLine()].EvalResult = acc.Print()
+				out[acc.GetLine()].EvalResult = formatResult(acc.Result(), options.Precision)
+				out[acc.GetLine()].Box = acc.Result()
 			}
-			acc = NewLineAccumulator(text, i, interpreter.converters)
+			acc = NewLineAccumulator(text, i, interpreter.converters, options.DefaultCurrency)
 			continue
 		}
 
@@ -140,17 +155,41 @@ func (interpreter *Interpreter) handleLineAccumulationCommands(out []*Interpreta
 
 	// first line case
 	if acc != nil {
-		out[acc.GetLine()].EvalResult = acc.Print()
+		out[acc.GetLine()].EvalResult = formatResult(acc.Result(), options.Precision)
+		out[acc.GetLine()].Box = acc.Result()
 		acc = nil
 	}
 }
 
+// Evaluates the text of a pipe line, which may be an assertion.
 func (interpreter *Interpreter) evaluateAndInterpretResult(
 	evaluator *evaluator.Evaluator,
 	collected string,
 	lineIndex int,
+	column int,
+	precision int,
+) *Interpretation {
+	expression, isAssertion := assertionExpression(collected)
+	interpretation := interpretExpression(evaluator, expression, lineIndex, column, precision)
+	interpretation.Text = collected
+	if isAssertion && len(interpretation.Diagnostics) == 0 {
+		checked, failure := checkAssertion(interpretation.Box, evaluator.GetComparisons(), expression, lineIndex, column, precision)
+		interpretation.Assertion = checked
+		if failure != nil {
+			interpretation.Diagnostics = append(interpretation.Diagnostics, failure)
+		}
+	}
+	return interpretation
+}
+
+func interpretExpression(
+	evaluator *evaluator.Evaluator,
+	expression string,
+	lineIndex int,
+	column int,
+	precision int,
 ) *Interpretation {
-	box := evaluator.EvalLine(collected)
+	box := evaluator.EvalLine(expression)
 	evalDiag := evaluator.GetDiagnostics()
 	lsDiag := []*lsproto.Diagnostic{}
 	if len(evalDiag) > 0 {
@@ -160,26 +199,28 @@ func (interpreter *Interpreter) evaluateAndInterpretResult(
 				Range: lsproto.Range{
 					Start: lsproto.Position{
 						Line:      uint32(lineIndex),
-						Character: uint32(e.StartPos),
+						Character: uint32(column + e.StartPos),
 					},
 					End: lsproto.Position{
 						Line:      uint32(lineIndex),
-						Character: uint32(e.EndPos),
+						Character: uint32(column + e.EndPos),
 					},
 				},
+				Source:  utils.PointerTo("puter"),
 				Message: e.Message,
 			})
 		}
 	}
 
-	decoration := ""
-	if box != nil {
-		decoration = box.Inspect()
-	}
+	decoration := formatResult(box, precision)
 	return &Interpretation{
+		Text:        expression,
 		LineIndex:   lineIndex,
 		Diagnostics: lsDiag,
 		EvalResult:  decoration,
 		Box:         box,
+		Column:      column,
+		Bindings:    evaluator.GetBindings(),
+		Conversions: evaluator.GetConversions(),
 	}
 }
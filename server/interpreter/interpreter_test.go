@@ -1,6 +1,9 @@
 package interpreter
 
 import (
+	"context"
+	"errors"
+	"puter/evaluation/evaluator/box"
 	"puter/unit"
 	"strconv"
 	"strings"
@@ -252,3 +255,461 @@ func TestPerformanceLargeFile(t *testing.T) {
 	t.Logf("Avg per line: %f", (elapsed / time.Duration(lineCount)).Seconds())
 	t.Logf("--------------------------")
 }
+
+func TestInterpretationColumnAndBindings(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	interpretations := interpreter.Interpret(joinLines(
+		"  // | x = 2 km",
+		"# |x in m",
+		"// | sum",
+	))
+	if len(interpretations) != 3 {
+		t.Fatalf("Expected 3 interpretations, got %d", len(interpretations))
+	}
+
+	expectedColumns := []int{6, 3, 4}
+	for i, interpretation := range interpretations {
+		if interpretation.Column != expectedColumns[i] {
+			t.Fatalf("Expected column of line %d to be %d, got %d", i, expectedColumns[i], interpretation.Column)
+		}
+	}
+
+	read := interpretations[1].Bindings[0]
+	if read.Name != "x" || read.Value.Inspect() != "2 kilometers" {
+		t.Fatalf("Expected x to be read as 2 kilometers, got %+v", read)
+	}
+	if len(interpretations[1].Conversions) != 1 {
+		t.Fatalf("Expected 1 conversion, got %d", len(interpretations[1].Conversions))
+	}
+	if interpretations[2].Box == nil || interpretations[2].Box.Inspect() != "4 kilometers" {
+		t.Fatalf("Expected the accumulation box to be set")
+	}
+}
+
+func TestWrittenResultIsIgnored(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	text := joinLines(
+		"// | x = 2 + 3  => 4",
+		"// | x * 2 =>",
+	)
+	// Only the commands that read files leave written results out.
+	interpretations := interpreter.Interpret(text)
+	if interpretations[0].Text != " x = 2 + 3  => 4" || len(interpretations[0].Diagnostics) == 0 {
+		t.Fatalf("Expected the whole line to be evaluated, got %q", interpretations[0].Text)
+	}
+
+	interpreter.SetOptions(FileOptions())
+	interpretations = interpreter.Interpret(text)
+	if len(interpretations) != 2 {
+		t.Fatalf("Expected 2 interpretations, got %d", len(interpretations))
+	}
+	if interpretations[0].Text != " x = 2 + 3" || interpretations[0].EvalResult != "5" {
+		t.Fatalf("Expected the written result to be left out, got %q = %q", interpretations[0].Text, interpretations[0].EvalResult)
+	}
+	if interpretations[1].EvalResult != "10" || len(interpretations[1].Diagnostics) != 0 {
+		t.Fatalf("Expected 10 without diagnostics, got %q", interpretations[1].EvalResult)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	interpretations := interpreter.Interpret(joinLines(
+		"// | x = 7 kg",
+		"// | assert x > 5 kg",
+		"// | x == 7 kg ?",
+		"// | assert x < 5 kg",
+		"// | assert x",
+		"// | assert = 3",
+		"// | 1 + 1",
+	))
+	if len(interpretations) != 7 {
+		t.Fatalf("Expected 7 interpretations, got %d", len(interpretations))
+	}
+
+	for _, i := range []int{1, 2} {
+		assertion := interpretations[i].Assertion
+		if assertion == nil || !assertion.Passed || len(interpretations[i].Diagnostics) != 0 {
+			t.Fatalf("Expected line %d to pass, got %+v and %d diagnostics", i, assertion, len(interpretations[i].Diagnostics))
+		}
+	}
+
+	failed := interpretations[3]
+	if failed.Assertion == nil || failed.Assertion.Passed || failed.Assertion.Comparison.Left.Inspect() != "7 kilograms" {
+		t.Fatalf("Expected line 3 to fail comparing 7 kilograms, got %+v", failed.Assertion)
+	}
+	if len(failed.Diagnostics) != 1 {
+		t.Fatalf("Expected a single diagnostic, got %d", len(failed.Diagnostics))
+	}
+	diagnostic := failed.Diagnostics[0]
+	if diagnostic.Message != "Assertion failed: expected < 5 kilograms, got 7 kilograms" || *diagnostic.Code.String != AssertionFailedCode {
+		t.Fatalf("Unexpected diagnostic %q", diagnostic.Message)
+	}
+	if diagnostic.Range.Start.Character != 12 || diagnostic.Range.End.Character != 20 {
+		t.Fatalf("Expected the diagnostic to cover 12-20, got %d-%d", diagnostic.Range.Start.Character, diagnostic.Range.End.Character)
+	}
+
+	if len(interpretations[4].Diagnostics) != 1 || interpretations[4].Diagnostics[0].Message != "An assertion must be true or false, got 7 kilograms" {
+		t.Fatalf("Expected a value that is no boolean to be reported")
+	}
+	for _, i := range []int{5, 6} {
+		if interpretations[i].Assertion != nil || len(interpretations[i].Diagnostics) != 0 {
+			t.Fatalf("Expected line %d to be no assertion", i)
+		}
+	}
+}
+
+func TestDiagnosticRangeIncludesColumn(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	interpretations := interpreter.Interpret("    // | 1 + missing")
+	if len(interpretations) != 1 || len(interpretations[0].Diagnostics) != 1 {
+		t.Fatalf("Expected a single diagnostic")
+	}
+	diagnostic := interpretations[0].Diagnostics[0]
+	if diagnostic.Range.Start.Character != 13 || diagnostic.Range.End.Character != 20 {
+		t.Fatalf("Expected diagnostic to cover 13-20, got %d-%d", diagnostic.Range.Start.Character, diagnostic.Range.End.Character)
+	}
+}
+
+func TestReinterpretMatchesInterpret(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	versions := []string{
+		joinLines(
+			"// | a = 2",
+			"// | b = a * 3",
+			"const x = 1;",
+			"// | c = 10",
+			"// | b + c",
+			"// | sum",
+		),
+		// change a, b and everything reading b follows
+		joinLines(
+			"// | a = 4",
+			"// | b = a * 3",
+			"const x = 1;",
+			"// | c = 10",
+			"// | b + c",
+			"// | sum",
+		),
+		// insert a non-pipe line, lines below move down
+		joinLines(
+			"// | a = 4",
+			"let y = 2;",
+			"// | b = a * 3",
+			"const x = 1;",
+			"// | c = 10",
+			"// | b + c",
+			"// | sum",
+		),
+		// remove the assignment of a, b can no longer be evaluated
+		joinLines(
+			"let y = 2;",
+			"// | b = a * 3",
+			"const x = 1;",
+			"// | c = 10",
+			"// | b + c",
+			"// | sum",
+		),
+		// define a again further down, only lines after it see it
+		joinLines(
+			"let y = 2;",
+			"// | b = a * 3",
+			"// | a = 1",
+			"// | c = 10 + a",
+			"// | b + c",
+			"// | sum",
+		),
+	}
+
+	var previous []*Interpretation
+	for v, text := range versions {
+		incremental := interpreter.Reinterpret(previous, text)
+		full := interpreter.Interpret(text)
+		if len(incremental) != len(full) {
+			t.Fatalf("version %d: expected %d interpretations, got %d", v, len(full), len(incremental))
+		}
+		for i := range full {
+			if incremental[i].EvalResult != full[i].EvalResult || incremental[i].LineIndex != full[i].LineIndex {
+				t.Fatalf("version %d line %d: expected %q at %d, got %q at %d",
+					v, i, full[i].EvalResult, full[i].LineIndex, incremental[i].EvalResult, incremental[i].LineIndex)
+			}
+			if len(incremental[i].Diagnostics) != len(full[i].Diagnostics) {
+				t.Fatalf("version %d line %d: expected %d diagnostics, got %d", v, i, len(full[i].Diagnostics), len(incremental[i].Diagnostics))
+			}
+			for d := range full[i].Diagnostics {
+				if incremental[i].Diagnostics[d].Range != full[i].Diagnostics[d].Range {
+					t.Fatalf("version %d line %d: expected diagnostic at %v, got %v", v, i, full[i].Diagnostics[d].Range, incremental[i].Diagnostics[d].Range)
+				}
+			}
+		}
+		previous = incremental
+	}
+}
+
+func TestReinterpretOnlyEvaluatesAffectedLines(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	previous := interpreter.Interpret(joinLines(
+		"// | a = 1",
+		"// | b = 2",
+		"// | a + 1",
+		"// | b + 1",
+		"// | a = 5",
+		"// | a + b",
+	))
+	next := interpreter.Reinterpret(previous, joinLines(
+		"// | a = 1",
+		"// | b = 3",
+		"// | a + 1",
+		"// | b + 1",
+		"// | a = 5",
+		"// | a + b",
+	))
+
+	reused := []bool{true, false, true, false, true, false}
+	for i, expected := range reused {
+		if (next[i] == previous[i]) != expected {
+			t.Fatalf("Expected reuse of line %d to be %t", i, expected)
+		}
+	}
+	if next[5].EvalResult != "8" {
+		t.Fatalf("Expected a + b to be 8, got %s", next[5].EvalResult)
+	}
+}
+
+func TestReinterpretStopsWhenValueIsUnchanged(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	previous := interpreter.Interpret(joinLines(
+		"// | a = 1",
+		"// | b = a * 0",
+		"// | b + 1",
+	))
+	next := interpreter.Reinterpret(previous, joinLines(
+		"// | a = 2",
+		"// | b = a * 0",
+		"// | b + 1",
+	))
+	if next[1] == previous[1] {
+		t.Fatalf("Expected b to be evaluated again since a changed")
+	}
+	if next[2] != previous[2] {
+		t.Fatalf("Expected b + 1 to be reused since b is still 0")
+	}
+}
+
+func TestPerformanceLargeFileSingleEdit(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+
+	lineCount := 10000
+	lines := make([]string, lineCount)
+	for i := 0; i < lineCount; i++ {
+		if i%10 == 0 {
+			lines[i] = "// | x" + strconv.Itoa(i) + " = 1 + " + strconv.Itoa(i)
+		} else {
+			lines[i] = "const x" + strconv.Itoa(i) + " = () => { console.log('hello'); };"
+		}
+	}
+	previous := interpreter.Interpret(strings.Join(lines, "\n"))
+
+	lines[lineCount/2] = "// | x" + strconv.Itoa(lineCount/2) + " = 2 + " + strconv.Itoa(lineCount/2)
+	editedText := strings.Join(lines, "\n")
+
+	start := time.Now()
+	incremental := interpreter.Reinterpret(previous, editedText)
+	incrementalElapsed := time.Since(start)
+
+	start = time.Now()
+	interpreter.Interpret(editedText)
+	fullElapsed := time.Since(start)
+
+	if incremental[len(incremental)/2].EvalResult != strconv.Itoa(2+lineCount/2) {
+		t.Fatalf("Expected the edited line to be evaluated again, got %s", incremental[len(incremental)/2].EvalResult)
+	}
+
+	t.Logf("\n--- Performance Result ---")
+	t.Logf("Full:         %f", fullElapsed.Seconds())
+	t.Logf("Incremental:  %f", incrementalElapsed.Seconds())
+	t.Logf("--------------------------")
+}
+
+func TestCommentMarkersOption(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	options := DefaultOptions()
+	options.CommentMarkers = []string{"--", ";"}
+	interpreter.SetOptions(options)
+
+	interpretations := interpreter.Interpret(joinLines(
+		"-- | 1 + 2",
+		"  ; |3 * 3",
+		"// | 4",
+		"- - | 5",
+	))
+	expected := []string{"3", "9", "5"}
+	if len(interpretations) != len(expected) {
+		t.Fatalf("Expected %d interpretations, got %d", len(expected), len(interpretations))
+	}
+	for i, interpretation := range interpretations {
+		if interpretation.EvalResult != expected[i] {
+			t.Fatalf("Expected %s, got %s", expected[i], interpretation.EvalResult)
+		}
+	}
+}
+
+func TestLanguageCommentMarkers(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	cases := []struct {
+		languageId string
+		text       string
+		expected   []string
+		suffixes   []string
+	}{
+		{"sql", joinLines("-- | 1 + 2", "// | 4", "select 1 -- | 5"), []string{"3"}, []string{""}},
+		// A comment that is not closed on the line may go on below it.
+		{"html", joinLines("<!-- | 1 + 2 -->", "  <!--|3 * 3-->  ", "<!-- | 4"), []string{"3", "9", "4"}, []string{"-->", "-->", ""}},
+		{"bat", joinLines("rem | 1 + 2", "REM | 2 * 3", ":: | 4"), []string{"3", "6", "4"}, []string{"", "", ""}},
+		// Languages without markers of their own use the comment markers.
+		{"go", joinLines("// | 1 + 2", "-- | 4"), []string{"3"}, []string{""}},
+		{"", joinLines("# | 1 + 2"), []string{"3"}, []string{""}},
+	}
+	for _, c := range cases {
+		interpretations, err := interpreter.ReinterpretLanguage(t.Context(), c.languageId, nil, c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(interpretations) != len(c.expected) {
+			t.Fatalf("%s: expected %d interpretations, got %d", c.languageId, len(c.expected), len(interpretations))
+		}
+		for i, interpretation := range interpretations {
+			if interpretation.EvalResult != c.expected[i] || interpretation.Suffix != c.suffixes[i] {
+				t.Errorf("%s: expected %s before %q, got %s before %q", c.languageId, c.expected[i], c.suffixes[i], interpretation.EvalResult, interpretation.Suffix)
+			}
+		}
+	}
+}
+
+func TestLanguageCommentMarkersOption(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	options := DefaultOptions()
+	options.LanguageCommentMarkers["sql"] = []string{"#"}
+	options.LanguageCommentMarkers["fortran"] = []string{"!"}
+	interpreter.SetOptions(options)
+
+	for languageId, text := range map[string]string{"sql": "-- | 1\n# | 2 + 3", "fortran": "! | 2 + 3"} {
+		interpretations, err := interpreter.ReinterpretLanguage(t.Context(), languageId, nil, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(interpretations) != 1 || interpretations[0].EvalResult != "5" {
+			t.Errorf("%s: expected only 5, got %d interpretations", languageId, len(interpretations))
+		}
+	}
+	if markers := DefaultLanguageCommentMarkers()["sql"]; len(markers) != 1 || markers[0] != "--" {
+		t.Errorf("changing the options changed the default markers to %q", markers)
+	}
+}
+
+func TestLanguageOfFile(t *testing.T) {
+	for name, expected := range map[string]string{
+		"queries/report.SQL": "sql",
+		"notes.md":           "markdown",
+		"index.htm":          "html",
+		"notes.txt":          "",
+		"Makefile":           "",
+	} {
+		if language := LanguageOfFile(name); language != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, language)
+		}
+	}
+}
+
+func TestPrecisionOption(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	options := DefaultOptions()
+	options.Precision = 2
+	interpreter.SetOptions(options)
+
+	interpretations := interpreter.Interpret(joinLines(
+		"// | 1 / 3",
+		"// | 2.5 usd",
+		"// | 1 km / 3",
+		"// | 1000000 * 1000000",
+		"// | 31 in hex",
+	))
+	expected := []string{"0.33", "2.5 usd", "0.33 kilometers", "1000000000000", "0x1f"}
+	for i, interpretation := range interpretations {
+		if interpretation.EvalResult != expected[i] {
+			t.Fatalf("Expected %s, got %s", expected[i], interpretation.EvalResult)
+		}
+	}
+}
+
+func TestDefaultCurrencyOption(t *testing.T) {
+	text := joinLines(
+		"// | 2 usd",
+		"// | 5 thb",
+		"// | sum",
+		"// | 1 usd",
+		"// | 3 usd",
+		"// | sum",
+	)
+
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	options := DefaultOptions()
+	options.DefaultCurrency = "eur"
+	interpreter.SetOptions(options)
+
+	interpretations := interpreter.Interpret(text)
+	if interpretations[2].EvalResult != "400 eur" {
+		t.Fatalf("Expected mixed currencies to be totalled in eur, got %s", interpretations[2].EvalResult)
+	}
+	if interpretations[5].EvalResult != "4 usd" {
+		t.Fatalf("Expected a single currency to be kept, got %s", interpretations[5].EvalResult)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	interpretations := interpreter.Interpret(joinLines("// | x = 2 m"))
+	variables := map[string]box.Box{"x": interpretations[0].Box}
+
+	interpretation := interpreter.Evaluate(t.Context(), "60 * 60 * 24", nil, 0, 0)
+	if interpretation.EvalResult != "86400" {
+		t.Fatalf("Expected 86400, got %s", interpretation.EvalResult)
+	}
+
+	interpretation = interpreter.Evaluate(t.Context(), "x * 3", variables, 0, 0)
+	if interpretation.EvalResult != "6 meters" {
+		t.Fatalf("Expected the variable to be visible, got %s", interpretation.EvalResult)
+	}
+
+	interpretation = interpreter.Evaluate(t.Context(), "x + y", variables, 4, 10)
+	if len(interpretation.Diagnostics) != 1 {
+		t.Fatalf("Expected a single diagnostic, got %d", len(interpretation.Diagnostics))
+	}
+	start := interpretation.Diagnostics[0].Range.Start
+	if start.Line != 4 || start.Character != 14 {
+		t.Fatalf("Expected the diagnostic at 4:14, got %d:%d", start.Line, start.Character)
+	}
+
+	// Only pipe lines are assertions, a comparison that doesn't hold is just false.
+	interpretation = interpreter.Evaluate(t.Context(), "2 < 1 ?", nil, 0, 0)
+	if interpretation.Assertion != nil || len(interpretation.Diagnostics) > 0 || interpretation.EvalResult != "false" {
+		t.Fatalf("Expected false without an assertion, got %s and %+v", interpretation.EvalResult, interpretation.Diagnostics)
+	}
+	interpretation = interpreter.Evaluate(t.Context(), "assert 2 < 1", nil, 0, 0)
+	if interpretation.Assertion != nil || len(interpretation.Diagnostics) == 0 || interpretation.Diagnostics[0].Code != nil {
+		t.Fatalf("Expected assert to be evaluated as an identifier, got %+v", interpretation.Diagnostics)
+	}
+}
+
+func TestReinterpretContextCancelled(t *testing.T) {
+	interpreter := NewInterpreter(t.Context(), getDefaultCurrencyConverter(200))
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	interpretations, err := interpreter.ReinterpretContext(ctx, nil, joinLines("// | 1 + 2", "// | 3"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the evaluation to be cancelled, got %v", err)
+	}
+	if interpretations != nil {
+		t.Fatalf("Expected no interpretations, got %d", len(interpretations))
+	}
+}
@@ -0,0 +1,89 @@
+package interpreter
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+)
+
+// Comment markers of the languages whose comments don't start with `//` or `#`, keyed by
+// their LSP language id. Languages that are not listed use Options.CommentMarkers.
+var defaultLanguageCommentMarkers = map[string][]string{
+	"sql":      {"--"},
+	"lua":      {"--"},
+	"haskell":  {"--"},
+	"elm":      {"--"},
+	"ada":      {"--"},
+	"clojure":  {";"},
+	"lisp":     {";"},
+	"scheme":   {";"},
+	"racket":   {";"},
+	"asm":      {";", "#"},
+	"ini":      {";", "#"},
+	"latex":    {"%"},
+	"tex":      {"%"},
+	"bibtex":   {"%"},
+	"erlang":   {"%"},
+	"matlab":   {"%"},
+	"prolog":   {"%"},
+	"vb":       {"'"},
+	"bat":      {"REM", "::"},
+	"html":     {"<!-- | -->"},
+	"xml":      {"<!-- | -->"},
+	"markdown": {"//", "#", "<!-- | -->"},
+	"css":      {"/* | */"},
+}
+
+// Returns the comment markers of every language that has its own, ready to be changed.
+func DefaultLanguageCommentMarkers() map[string][]string {
+	markers := maps.Clone(defaultLanguageCommentMarkers)
+	for language, languageMarkers := range markers {
+		markers[language] = append([]string{}, languageMarkers...)
+	}
+	return markers
+}
+
+// Language ids of file extensions, for files that are not opened by an editor that
+// knows their language.
+var extensionLanguages = map[string]string{
+	".sql":  "sql",
+	".lua":  "lua",
+	".hs":   "haskell",
+	".elm":  "elm",
+	".adb":  "ada",
+	".ads":  "ada",
+	".clj":  "clojure",
+	".lisp": "lisp",
+	".el":   "lisp",
+	".scm":  "scheme",
+	".rkt":  "racket",
+	".asm":  "asm",
+	".s":    "asm",
+	".ini":  "ini",
+	".tex":  "latex",
+	".bib":  "bibtex",
+	".erl":  "erlang",
+	".vb":   "vb",
+	".bas":  "vb",
+	".bat":  "bat",
+	".cmd":  "bat",
+	".html": "html",
+	".htm":  "html",
+	".xml":  "xml",
+	".svg":  "xml",
+	".md":   "markdown",
+	".css":  "css",
+}
+
+// Returns the language id of a file from its extension, empty when it is not known.
+func LanguageOfFile(name string) string {
+	return extensionLanguages[strings.ToLower(filepath.Ext(name))]
+}
+
+// Returns the comment markers of documents of the language with the LSP id languageId.
+func (options Options) commentMarkers(languageId string) []string {
+	if markers, ok := options.LanguageCommentMarkers[languageId]; ok {
+		return markers
+	}
+	return options.CommentMarkers
+}
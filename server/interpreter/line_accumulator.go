@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"puter/evaluation/evaluator/box"
 	"puter/unit"
+	"strings"
 )
 
 var startingValues = map[string]float64{
@@ -20,9 +21,12 @@ type LineAccumulator struct {
 	acc        box.Box
 	operation  func(a, b float64) float64
 	converters *unit.Converters
+	// Currency that lines in different currencies are accumulated in, empty to keep the
+	// currency of the first line.
+	defaultCurrency string
 }
 
-func NewLineAccumulator(command string, line int, converters *unit.Converters) *LineAccumulator {
+func NewLineAccumulator(command string, line int, converters *unit.Converters, defaultCurrency string) *LineAccumulator {
 	if !IsAccumulationCommand(command) {
 		panic(fmt.Sprintf("Invalid line command. Got %s", command))
 	}
@@ -33,6 +37,7 @@ func NewLineAccumulator(command string, line int, converters *unit.Converters) *
 		nil,
 		operation,
 		converters,
+		defaultCurrency,
 	}
 	return got
 }
@@ -44,16 +49,26 @@ func (l *LineAccumulator) Print() string {
 	return l.acc.Inspect()
 }
 
+// The accumulated value, nil if nothing was accepted.
+func (l *LineAccumulator) Result() box.Box {
+	return l.acc
+}
+
 func (l *LineAccumulator) GetLine() int {
 	return l.line
 }
 
 // If result is not a valid type, this method does nothing.
 func (l *LineAccumulator) Accept(result box.Box) {
+	if result == nil {
+		return
+	}
 	if l.acc == nil {
 		l.setStartingAcc(result)
 	}
 
+	result = l.toDefaultCurrency(result)
+
 	operatable, ok := l.acc.(box.BinaryNumberOperatable)
 	if !ok {
 		return
@@ -65,6 +80,28 @@ func (l *LineAccumulator) Accept(result box.Box) {
 	l.acc = newAcc
 }
 
+// Once a second currency shows up, the accumulated value and every line after it are
+// converted to the default currency. Returns result in the currency it should be added in.
+func (l *LineAccumulator) toDefaultCurrency(result box.Box) box.Box {
+	acc, accIsCurrency := l.acc.(*box.CurrencyBox)
+	next, nextIsCurrency := result.(*box.CurrencyBox)
+	if l.defaultCurrency == "" || !accIsCurrency || !nextIsCurrency || strings.EqualFold(acc.Unit, next.Unit) {
+		return result
+	}
+	if !strings.EqualFold(acc.Unit, l.defaultCurrency) {
+		converted, err := acc.OperateIn(l.defaultCurrency, l.converters)
+		if err != nil {
+			return result
+		}
+		l.acc = converted
+	}
+	converted, err := next.OperateIn(l.defaultCurrency, l.converters)
+	if err != nil {
+		return result
+	}
+	return converted
+}
+
 func (l *LineAccumulator) setStartingAcc(result box.Box) {
 	num := startingValues[l.command]
 	switch v := result.(type) {
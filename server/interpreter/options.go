@@ -0,0 +1,120 @@
+package interpreter
+
+import (
+	"puter/evaluation/evaluator/box"
+	"puter/unit"
+	"strconv"
+	"strings"
+)
+
+// Settings that change how pipe lines are found and how they are evaluated.
+type Options struct {
+	// Comment markers a pipe line can start with, `//` for `// | 1 + 2`. A marker can also
+	// end the line, `<!-- | -->` is for `<!-- | 1 + 2 -->`.
+	CommentMarkers []string
+	// Comment markers by LSP language id, used instead of CommentMarkers for documents
+	// of those languages.
+	LanguageCommentMarkers map[string][]string
+	// Number of decimal places results are rounded to, negative to print them as they are.
+	Precision int
+	// Currency that accumulation commands total lines in different currencies in.
+	// Empty to keep the currency of the first line.
+	DefaultCurrency string
+	// Whether `^` raises to a power instead of being a bitwise xor.
+	CaretIsExponent bool
+	// Whether a result written after a pipe line, like the `=> 3` that `puter eval --write`
+	// writes into `// | 1 + 2  => 3`, is left out of its expression. Off in the editor,
+	// which shows results on its own, `=>` is no operator there either.
+	WrittenResults bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		CommentMarkers:         []string{"//", "#"},
+		LanguageCommentMarkers: DefaultLanguageCommentMarkers(),
+		Precision:              -1,
+	}
+}
+
+// Options for the files that the commands of puter read, which may hold results written
+// by `puter eval --write`.
+func FileOptions() Options {
+	options := DefaultOptions()
+	options.WrittenResults = true
+	return options
+}
+
+// Returns the index of the pipe if line is a pipe line for one of markers, -1 otherwise,
+// and what ends the comment of the marker, if anything does. Spaces are ignored up to the
+// pipe, so `// |`, `//|` and `  # |` all count, and so is case, `rem |` is the same as `REM |`.
+func pipeIndex(line string, markers []string) (int, string) {
+	for _, marker := range markers {
+		opening, closing, _ := strings.Cut(marker, "|")
+		expected := strings.ToLower(strings.ReplaceAll(opening, " ", "")) + "|"
+		matched := 0
+		for i := 0; i < len(line); i++ {
+			if line[i] == ' ' {
+				continue
+			}
+			if lower(line[i]) != expected[matched] {
+				break
+			}
+			matched++
+			if matched == len(expected) {
+				return i, strings.TrimSpace(closing)
+			}
+		}
+	}
+	return -1, ""
+}
+
+// Reports whether marker can be used as a comment marker: it can't be blank, and a pipe
+// only separates the opening from the closing of the comment.
+func ValidCommentMarker(marker string) bool {
+	opening, closing, _ := strings.Cut(marker, "|")
+	return strings.TrimSpace(opening) != "" && !strings.Contains(closing, "|")
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// Formats a result for display, rounded to precision decimal places when it is not negative.
+func formatResult(value box.Box, precision int) string {
+	if value == nil {
+		return ""
+	}
+	if precision < 0 {
+		return value.Inspect()
+	}
+	switch v := value.(type) {
+	case *box.NumberBox:
+		if v.NumberType != box.Decimal {
+			return v.Inspect()
+		}
+		return roundedNumber(v.Value, precision)
+	case *box.FixedUnitBox:
+		return formatResult(v.Number, precision) + " " + unit.FixedUnitTypes[v.FixedUnitType].FullName
+	case *box.CurrencyBox:
+		return formatResult(v.Number, precision) + " " + v.Unit
+	case *box.PercentBox:
+		return roundedNumber(v.Value, precision) + "%"
+	default:
+		return value.Inspect()
+	}
+}
+
+// 1/3 is 0.33 with a precision of 2, but 2.5 stays 2.5 rather than becoming 2.50.
+func roundedNumber(value float64, precision int) string {
+	text := strconv.FormatFloat(value, 'f', precision, 64)
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	if text == "-0" {
+		return "0"
+	}
+	return text
+}
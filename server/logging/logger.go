@@ -1,12 +1,49 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"sync"
 	"time"
 )
 
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	// Details that only help when following what the server does message by message.
+	LevelVerbose
+)
+
+var levelNames = []string{"error", "warn", "info", "verbose"}
+
+func (level Level) String() string {
+	if level < LevelError || level > LevelVerbose {
+		return fmt.Sprintf("level(%d)", int(level))
+	}
+	return levelNames[level]
+}
+
+// Parses the name of a level, as String returns it.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if name == levelName {
+			return Level(level), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of error, warn, info or verbose", name)
+}
+
+// Receives the messages of a logger besides its output, see Logger.WithForwarder.
+type Forwarder interface {
+	// Reports whether messages of level are wanted, even if the logger doesn't write them.
+	Forwards(level Level) bool
+	Forward(level Level, message string)
+}
+
 type Logger interface {
 	// Error logs an error message.
 	Error(msg ...any)
@@ -20,9 +57,9 @@ type Logger interface {
 	Info(msg ...any)
 	// Infof logs a formatted info message.
 	Infof(format string, args ...any)
-	// Log prints a line to the output writer with a header.
+	// Log logs a verbose message.
 	Log(msg ...any)
-	// Logf prints a formatted line to the output writer with a header.
+	// Logf logs a formatted verbose message.
 	Logf(format string, args ...any)
 
 	// Verbose returns the logger instance if verbose logging is enabled, and otherwise returns nil.
@@ -32,94 +69,173 @@ type Logger interface {
 	IsVerbose() bool
 	// SetVerbose sets the verbose logging flag.
 	SetVerbose(verbose bool)
+	// SetLevel sets the most detailed level written to the output.
+	SetLevel(level Level)
+	// Level returns the most detailed level written to the output.
+	Level() Level
+	// WithForwarder returns a logger that writes to the same output, at the same level,
+	// and passes every message to forwarder as well.
+	WithForwarder(forwarder Forwarder) Logger
 }
 
 var _ Logger = (*logger)(nil)
 
+// Where messages are written, shared by a logger and the loggers made from it.
+type output struct {
+	mu     sync.Mutex
+	level  Level
+	json   bool
+	writer io.Writer
+	now    func() time.Time
+}
+
 type logger struct {
-	mu      sync.Mutex
-	verbose bool
-	writer  io.Writer
-	prefix  func() string
+	out       *output
+	forwarder Forwarder
 }
 
-func (l *logger) Log(msg ...any) {
+// A line of the JSON output.
+type record struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+func (l *logger) log(level Level, message func() string) {
 	if l == nil {
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	fmt.Fprintln(l.writer, l.prefix(), fmt.Sprint(msg...))
+	write := level <= l.Level()
+	forward := l.forwarder != nil && l.forwarder.Forwards(level)
+	if !write && !forward {
+		return
+	}
+
+	text := message()
+	if write {
+		l.out.write(level, text)
+	}
+	if forward {
+		l.forwarder.Forward(level, text)
+	}
 }
 
-func (l *logger) Logf(format string, args ...any) {
-	if l == nil {
+func (o *output) write(level Level, message string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	if o.json {
+		line, err := json.Marshal(record{Time: now, Level: level.String(), Message: message})
+		if err != nil {
+			return
+		}
+		o.writer.Write(append(line, '\n'))
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	fmt.Fprintf(l.writer, "%s %s\n", l.prefix(), fmt.Sprintf(format, args...))
+	fmt.Fprintf(o.writer, "%s [%s] %s\n", formatTime(now), level, message)
 }
 
-func (l *logger) Verbose() Logger {
+func (l *logger) enabled(level Level) bool {
 	if l == nil {
-		return nil
+		return false
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if !l.verbose {
-		return nil
+	return level <= l.Level() || (l.forwarder != nil && l.forwarder.Forwards(level))
+}
+
+func (l *logger) Log(msg ...any) {
+	l.log(LevelVerbose, func() string { return fmt.Sprint(msg...) })
+}
+
+func (l *logger) Logf(format string, args ...any) {
+	l.log(LevelVerbose, func() string { return fmt.Sprintf(format, args...) })
+}
+
+func (l *logger) Verbose() Logger {
+	if !l.enabled(LevelVerbose) {
+		return (*logger)(nil)
 	}
 	return l
 }
 
 func (l *logger) IsVerbose() bool {
-	if l == nil {
-		return false
-	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.verbose
+	return l.enabled(LevelVerbose)
 }
 
 func (l *logger) SetVerbose(verbose bool) {
+	if verbose {
+		l.SetLevel(LevelVerbose)
+	} else {
+		l.SetLevel(LevelInfo)
+	}
+}
+
+func (l *logger) SetLevel(level Level) {
 	if l == nil {
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.verbose = verbose
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.level = level
+}
+
+func (l *logger) Level() Level {
+	if l == nil {
+		return LevelError
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return l.out.level
+}
+
+func (l *logger) WithForwarder(forwarder Forwarder) Logger {
+	if l == nil {
+		return nil
+	}
+	return &logger{out: l.out, forwarder: forwarder}
 }
 
 func (l *logger) Error(msg ...any) {
-	l.Log(msg...)
+	l.log(LevelError, func() string { return fmt.Sprint(msg...) })
 }
 
 func (l *logger) Errorf(format string, args ...any) {
-	l.Logf(format, args...)
+	l.log(LevelError, func() string { return fmt.Sprintf(format, args...) })
 }
 
 func (l *logger) Warn(msg ...any) {
-	l.Log(msg...)
+	l.log(LevelWarn, func() string { return fmt.Sprint(msg...) })
 }
 
 func (l *logger) Warnf(format string, args ...any) {
-	l.Logf(format, args...)
+	l.log(LevelWarn, func() string { return fmt.Sprintf(format, args...) })
 }
 
 func (l *logger) Info(msg ...any) {
-	l.Log(msg...)
+	l.log(LevelInfo, func() string { return fmt.Sprint(msg...) })
 }
 
 func (l *logger) Infof(format string, args ...any) {
-	l.Logf(format, args...)
+	l.log(LevelInfo, func() string { return fmt.Sprintf(format, args...) })
 }
 
+// Returns a logger that writes info messages and above as text lines.
 func NewLogger(output io.Writer) Logger {
+	return NewLoggerWithOptions(output, Options{Level: LevelInfo})
+}
+
+type Options struct {
+	Level Level
+	// Writes every message as a JSON object on a line of its own instead of as text.
+	JSON bool
+}
+
+func NewLoggerWithOptions(writer io.Writer, options Options) Logger {
 	return &logger{
-		writer: output,
-		prefix: func() string {
-			return formatTime(time.Now())
+		out: &output{
+			level:  options.Level,
+			json:   options.JSON,
+			writer: writer,
+			now:    time.Now,
 		},
 	}
 }
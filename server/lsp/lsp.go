@@ -55,8 +55,9 @@ func unmarshalAny(data []byte) (any, error) {
 	return v, nil
 }
 
+// Accepts params that are left out, or explicitly null as some clients send for `shutdown` and `exit`.
 func unmarshalEmpty(data []byte) (any, error) {
-	if len(data) != 0 {
+	if len(data) != 0 && string(data) != "null" {
 		return nil, fmt.Errorf("expected empty, got: %s", string(data))
 	}
 	return nil, nil
@@ -2,44 +2,92 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
-	"puter/engine"
-	"puter/interpreter"
 	"puter/logging"
 	lsproto "puter/lsp"
+	"puter/replay"
 	"puter/unit"
+	"strings"
 	"syscall"
 )
 
 func main() {
-	logger := logging.NewLogger(os.Stderr)
-	logger.Info("Starting puter...\n")
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	listen := flag.String("listen", "", "serve clients over TCP on this address, like :7777, instead of stdio")
+	websocket := flag.String("websocket", "", "serve clients over WebSocket on this address, like :7778, instead of stdio")
+	websocketOrigins := flag.String("websocket-origins", "", "comma separated origins of web pages allowed to connect over WebSocket, like http://localhost:3000, or * for any")
+	record := flag.String("record", "", "record every message read and written to this file, to be replayed later")
+	logFile := flag.String("log-file", "", "write the log to this file instead of stderr")
+	logLevel := flag.String("log-level", "", "most detailed level to log: error, warn, info or verbose, info by default; when set, also the level sent to the client, which otherwise only gets warnings and errors")
+	logFormat := flag.String("log-format", "text", "format of the log: text or json")
+	flag.Parse()
+
+	level, clientLogLevel := logging.LevelInfo, logging.LevelWarn
+	if *logLevel != "" {
+		parsed, err := logging.ParseLevel(*logLevel)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		level, clientLogLevel = parsed, parsed
+	}
+	if *logFormat != "text" && *logFormat != "json" {
+		fmt.Fprintf(os.Stderr, "unknown log format %q, expected text or json\n", *logFormat)
+		os.Exit(2)
+	}
+	logOutput := io.Writer(os.Stderr)
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not open the log file:", err)
+			os.Exit(1)
+		}
+		logOutput = file
+	}
+	logger := logging.NewLoggerWithOptions(logOutput, logging.Options{Level: level, JSON: *logFormat == "json"})
+	logger.Info("Starting puter...")
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	inputReader := lsproto.NewBaseReader(os.Stdin)
-	outputWriter := lsproto.NewBaseWriter(os.Stdout)
-
-	currencyConverter := unit.GetCurrencyConverter()
-	fixedUnitConverter := unit.GetFixedUnitConverter()
-	converters := &unit.Converters{
-		ConvertCurrency:  currencyConverter,
-		ConvertFixedUnit: fixedUnitConverter,
+	s := &server{
+		logger:             logger,
+		clientLogLevel:     clientLogLevel,
+		exchangeRates:      unit.NewExchangeRates(),
+		fixedUnitConverter: unit.GetFixedUnitConverter(),
+	}
+	if *websocketOrigins != "" {
+		s.allowedOrigins = strings.Split(*websocketOrigins, ",")
+	}
+	if *record != "" {
+		file, err := os.Create(*record)
+		if err != nil {
+			logger.Error("could not record: ", err)
+			os.Exit(1)
+		}
+		s.recorder = replay.NewRecorder(file)
 	}
 
-	interpreter := interpreter.NewInterpreter(ctx, converters)
-
-	engine := engine.NewEngine(
-		ctx,
-		inputReader,
-		outputWriter,
-		logger,
-		interpreter,
-	)
+	if *listen == "" && *websocket == "" {
+		inputReader := lsproto.NewBaseReader(os.Stdin)
+		outputWriter := lsproto.NewBaseWriter(os.Stdout)
+		print("Engine running")
+		exitCode := s.serve(ctx, "stdio", inputReader, outputWriter)
+		print("Engine stopped")
+		os.Exit(exitCode)
+	}
 
-	print("Engine running")
-	engine.Run(ctx)
-	print("Engine stopped")
+	if err := s.listen(ctx, *listen, *websocket); err != nil {
+		logger.Error("server stopped: ", err)
+		os.Exit(1)
+	}
 }
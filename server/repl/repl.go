@@ -0,0 +1,173 @@
+// Package repl evaluates puter expressions typed in a terminal, line by line, with the
+// variables assigned by earlier lines.
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"puter/evaluation/ast"
+	"puter/evaluation/evaluator"
+	"puter/unit"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const help = `Type an expression to evaluate it, like 3 km in m or total = 12 * 4.
+Variables stay assigned until :clear.
+
+  :vars            list the variables
+  :units           list the unit families
+  :units <family>  list the units of a family, like :units length
+  :clear           forget the variables
+  :help            show this help
+  :quit            leave, as does Ctrl-D`
+
+// An evaluator kept alive across the lines of input.
+type Session struct {
+	ctx        context.Context
+	converters *unit.Converters
+	evaluator  *evaluator.Evaluator
+	out        io.Writer
+	// The prompt in front of the input on the screen, carets are shifted by its width.
+	// Empty when the input is not shown, the input is printed above the carets then.
+	prompt string
+}
+
+func NewSession(ctx context.Context, converters *unit.Converters, out io.Writer, prompt string) *Session {
+	return &Session{
+		ctx:        ctx,
+		converters: converters,
+		evaluator:  evaluator.NewEvaluator(ctx, converters),
+		out:        out,
+		prompt:     prompt,
+	}
+}
+
+// Evaluates a line of input, or runs it as a meta-command when it starts with a colon.
+// Returns false when the input asks to leave.
+func (s *Session) Handle(input string) bool {
+	trimmed := strings.TrimSpace(input)
+	if strings.HasPrefix(trimmed, ":") {
+		return s.command(strings.Fields(trimmed[1:]))
+	}
+	if trimmed == "" {
+		return true
+	}
+
+	result := s.evaluator.EvalLine(input)
+	if diagnostics := s.evaluator.GetDiagnostics(); len(diagnostics) > 0 {
+		s.printDiagnostics(input, diagnostics)
+		return true
+	}
+	if result != nil {
+		fmt.Fprintln(s.out, result.Inspect())
+	}
+	return true
+}
+
+func (s *Session) command(fields []string) bool {
+	if len(fields) == 0 {
+		fmt.Fprintln(s.out, help)
+		return true
+	}
+	switch name, args := fields[0], fields[1:]; name {
+	case "help", "h", "?":
+		fmt.Fprintln(s.out, help)
+	case "quit", "q", "exit":
+		return false
+	case "vars":
+		s.printVariables()
+	case "units":
+		if len(args) == 0 {
+			s.printFamilies()
+		} else {
+			s.printUnits(strings.ToLower(args[0]))
+		}
+	case "clear":
+		s.evaluator = evaluator.NewEvaluator(s.ctx, s.converters)
+		fmt.Fprintln(s.out, "variables cleared")
+	default:
+		fmt.Fprintf(s.out, "unknown command :%s, type :help for the commands\n", name)
+	}
+	return true
+}
+
+// Points at what each diagnostic is about with carets under the input.
+//
+//	> 2 + foo
+//	      ^^^ Unknown identifier foo
+func (s *Session) printDiagnostics(input string, diagnostics []*ast.Diagnostic) {
+	if s.prompt == "" {
+		fmt.Fprintln(s.out, input)
+	}
+	for _, diagnostic := range diagnostics {
+		start := min(max(diagnostic.StartPos, 0), len(input))
+		end := min(max(diagnostic.EndPos, start), len(input))
+		width := max(utf8.RuneCountInString(input[start:end]), 1)
+		fmt.Fprintf(s.out, "%s%s%s %s\n", blank(s.prompt), blank(input[:start]), strings.Repeat("^", width), diagnostic.Message)
+	}
+}
+
+// Replaces every character of text by a space, but keeps tabs so that carets line up
+// with input indented by them.
+func blank(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, text)
+}
+
+func (s *Session) printVariables() {
+	variables := s.evaluator.Variables()
+	for _, name := range slices.Sorted(maps.Keys(variables)) {
+		value := "no value"
+		if variables[name] != nil {
+			value = variables[name].Inspect()
+		}
+		fmt.Fprintf(s.out, "%s = %s\n", name, value)
+	}
+}
+
+// Currencies are listed as a family of their own.
+const currencyFamily = "currency"
+
+func families() []string {
+	families := []string{currencyFamily}
+	for _, detail := range unit.FixedUnitTypes {
+		if !slices.Contains(families, detail.UnitFor) {
+			families = append(families, detail.UnitFor)
+		}
+	}
+	slices.Sort(families)
+	return families
+}
+
+func (s *Session) printFamilies() {
+	fmt.Fprintln(s.out, strings.Join(families(), ", "))
+}
+
+func (s *Session) printUnits(family string) {
+	if family == currencyFamily {
+		fmt.Fprintln(s.out, strings.Join(slices.Sorted(maps.Keys(unit.FiatCurrencies)), ", "))
+		return
+	}
+	// Units are keyed by their full names as well, only the short names are listed.
+	lines := []string{}
+	for key, detail := range unit.FixedUnitTypes {
+		if detail.UnitFor != family || string(key) == detail.FullName || string(key) == detail.FullNameSingular {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-6s %s", key, detail.FullName))
+	}
+	if len(lines) == 0 {
+		fmt.Fprintf(s.out, "unknown unit family %s, expected one of %s\n", family, strings.Join(families(), ", "))
+		return
+	}
+	slices.Sort(lines)
+	fmt.Fprintln(s.out, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,143 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"puter/unit"
+	"strings"
+	"testing"
+)
+
+func newTestSession(prompt string) (*Session, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	converters := &unit.Converters{
+		ConvertCurrency: func(fromValue float64, fromUnit string, toUnit string) (float64, error) {
+			return fromValue * 2, nil
+		},
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+	return NewSession(context.Background(), converters, out, prompt), out
+}
+
+func TestSessionKeepsVariables(t *testing.T) {
+	session, out := newTestSession(prompt)
+	for _, input := range []string{"distance = 3 km", "", "distance in m", "distance * 2"} {
+		if !session.Handle(input) {
+			t.Fatalf("%q asked to leave", input)
+		}
+	}
+	expected := "3 kilometers\n3000 meters\n6 kilometers\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestSessionPointsAtDiagnostics(t *testing.T) {
+	cases := []struct {
+		prompt   string
+		input    string
+		expected string
+	}{
+		{prompt, "2 + foo", "      ^^^ Identifier foo not found\n"},
+		{"", "2 + foo", "2 + foo\n    ^^^ Identifier foo not found\n"},
+		{"", "\t2 + foo", "\t2 + foo\n\t    ^^^ Identifier foo not found\n"},
+		{prompt, "2 +", "     ^ Unrecognized prefix token EOF\n"},
+	}
+	for _, c := range cases {
+		session, out := newTestSession(c.prompt)
+		session.Handle(c.input)
+		if out.String() != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.input, c.expected, out.String())
+		}
+	}
+}
+
+func TestSessionCommands(t *testing.T) {
+	session, out := newTestSession(prompt)
+	session.Handle("x = 2")
+	session.Handle(":vars")
+	if !strings.Contains(out.String(), "x = 2\n") || !strings.Contains(out.String(), "pi = 3.14") {
+		t.Errorf(":vars printed %q", out.String())
+	}
+
+	out.Reset()
+	session.Handle(":clear")
+	session.Handle("x")
+	if !strings.Contains(out.String(), "Identifier x not found") {
+		t.Errorf("x is still assigned after :clear: %q", out.String())
+	}
+
+	out.Reset()
+	session.Handle(":units length")
+	if !strings.Contains(out.String(), "km     kilometers\n") || strings.Contains(out.String(), "kilograms") {
+		t.Errorf(":units length printed %q", out.String())
+	}
+
+	out.Reset()
+	session.Handle(":units")
+	if !strings.HasPrefix(out.String(), "currency, length, mass") {
+		t.Errorf(":units printed %q", out.String())
+	}
+
+	out.Reset()
+	session.Handle(":units colour")
+	if !strings.HasPrefix(out.String(), "unknown unit family colour") {
+		t.Errorf(":units colour printed %q", out.String())
+	}
+
+	if session.Handle(":quit") {
+		t.Errorf(":quit did not ask to leave")
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "puter", "history")
+	h := loadHistory(path)
+	for _, entry := range []string{"1 + 2", "1 + 2", " ", "x = 3", "y = 4", "x = 3"} {
+		h.Add(entry)
+	}
+	if h.Len() != 3 || h.At(0) != "x = 3" || h.At(1) != "y = 4" || h.At(2) != "1 + 2" {
+		t.Fatalf("unexpected entries %q", h.entries)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "1 + 2\ny = 4\nx = 3\n" {
+		t.Errorf("unexpected history file %q", content)
+	}
+
+	loaded := loadHistory(path)
+	if loaded.Len() != 3 || loaded.At(0) != "x = 3" {
+		t.Errorf("unexpected loaded entries %q", loaded.entries)
+	}
+}
+
+func TestHistoryFileIsTrimmed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var content strings.Builder
+	for i := range maxHistory + 10 {
+		fmt.Fprintf(&content, "x = %d\n", i%(maxHistory+5))
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := loadHistory(path)
+	if h.Len() != maxHistory || h.At(0) != "x = 4" {
+		t.Fatalf("unexpected entries, %d of them starting with %q", h.Len(), h.At(0))
+	}
+	h.Add("y = 1")
+	trimmed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(trimmed), "\n"), "\n")
+	if len(lines) != maxHistory || lines[len(lines)-1] != "y = 1" {
+		t.Errorf("unexpected history file of %d lines ending with %q", len(lines), lines[len(lines)-1])
+	}
+}
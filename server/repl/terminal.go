@@ -0,0 +1,144 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"puter/unit"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const prompt = "> "
+
+// Most lines kept in the history file.
+const maxHistory = 1000
+
+type Options struct {
+	// File the input is kept in between sessions, empty to only keep it for the session.
+	HistoryFile string
+}
+
+// Returns the history file used when none is given, in the cache directory of the user.
+func DefaultHistoryFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "puter", "repl_history")
+}
+
+// Reads lines from in until it ends or a line asks to leave. When in is a terminal
+// lines can be edited and earlier lines recalled with the arrow keys, otherwise lines
+// are evaluated as they are read, without a prompt.
+func Run(ctx context.Context, converters *unit.Converters, in *os.File, out io.Writer, options Options) error {
+	if !term.IsTerminal(int(in.Fd())) {
+		session := NewSession(ctx, converters, out, "")
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() && session.Handle(scanner.Text()) {
+		}
+		return scanner.Err()
+	}
+
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("repl: %w", err)
+	}
+	defer term.Restore(int(in.Fd()), state)
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, out}, prompt)
+	terminal.History = loadHistory(options.HistoryFile)
+	if width, height, err := term.GetSize(int(in.Fd())); err == nil && width > 0 {
+		terminal.SetSize(width, height)
+	}
+
+	// The terminal turns line feeds into the carriage return and line feed raw mode needs.
+	session := NewSession(ctx, converters, terminal, prompt)
+	fmt.Fprintln(terminal, "puter, type :help for the commands")
+	for {
+		line, err := terminal.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("repl: %w", err)
+		}
+		if !session.Handle(line) {
+			return nil
+		}
+	}
+}
+
+// Lines of input, the most recent first for term.History, that are written to a file
+// as they are added.
+type history struct {
+	path    string
+	entries []string
+}
+
+var _ term.History = (*history)(nil)
+
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0 && len(h.entries) < maxHistory; i-- {
+		if lines[i] != "" && !slices.Contains(h.entries, lines[i]) {
+			h.entries = append(h.entries, lines[i])
+		}
+	}
+	// Files that grew past the cap or hold duplicates are trimmed when they are read.
+	if len(h.entries) < len(lines) {
+		h.save()
+	}
+	return h
+}
+
+// Blank lines are not added, a line already in the history moves to the front.
+func (h *history) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	h.entries = slices.DeleteFunc(h.entries, func(e string) bool { return e == entry })
+	h.entries = append([]string{entry}, h.entries[:min(len(h.entries), maxHistory-1)]...)
+	h.save()
+}
+
+// Replaces the file with the entries, the oldest first.
+func (h *history) save() {
+	if h.path == "" {
+		return
+	}
+	// The history is a convenience, the session goes on when it can't be written.
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return
+	}
+	var content strings.Builder
+	for _, entry := range slices.Backward(h.entries) {
+		content.WriteString(entry + "\n")
+	}
+	os.WriteFile(h.path, []byte(content.String()), 0o600)
+}
+
+func (h *history) Len() int {
+	return len(h.entries)
+}
+
+func (h *history) At(index int) string {
+	return h.entries[index]
+}
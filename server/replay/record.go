@@ -0,0 +1,142 @@
+// Package replay records the messages of LSP sessions and plays recordings back to an
+// engine, so that a session reported with a bug can be turned into a test.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type Direction string
+
+const (
+	// Read from the client.
+	Incoming Direction = "in"
+	// Written to the client.
+	Outgoing Direction = "out"
+)
+
+// A message of a recording, one JSON object per line.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// The client the message belongs to, when the server serves several.
+	Session   string          `json:"session,omitempty"`
+	Direction Direction       `json:"direction"`
+	Message   json.RawMessage `json:"message,omitempty"`
+	// Content that is not JSON at all, kept as it was read.
+	Invalid string `json:"invalid,omitempty"`
+}
+
+// Same as engine.Reader and engine.Writer.
+type Reader interface {
+	Read() ([]byte, error)
+}
+
+type Writer interface {
+	Write(msg []byte) error
+}
+
+// Writes every message that passes through its readers and writers to a recording.
+type Recorder struct {
+	mu sync.Mutex
+	w  io.Writer
+	// Set by the first write that failed, nothing is recorded afterwards.
+	err error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// The first error writing the recording. Sessions go on without being recorded when
+// the recording can't be written, rather than failing.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(session string, direction Direction, data []byte) {
+	entry := Entry{Time: time.Now(), Session: session, Direction: direction}
+	if json.Valid(data) {
+		entry.Message = data
+	} else {
+		entry.Invalid = string(data)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		r.err = fmt.Errorf("replay: write recording: %w", err)
+	}
+}
+
+// Records the messages read by reader as incoming messages of session.
+func (r *Recorder) Reader(session string, reader Reader) Reader {
+	return &recordingReader{recorder: r, session: session, reader: reader}
+}
+
+// Records the messages written by writer as outgoing messages of session.
+func (r *Recorder) Writer(session string, writer Writer) Writer {
+	return &recordingWriter{recorder: r, session: session, writer: writer}
+}
+
+type recordingReader struct {
+	recorder *Recorder
+	session  string
+	reader   Reader
+}
+
+func (r *recordingReader) Read() ([]byte, error) {
+	data, err := r.reader.Read()
+	if err == nil {
+		r.recorder.record(r.session, Incoming, data)
+	}
+	return data, err
+}
+
+type recordingWriter struct {
+	recorder *Recorder
+	session  string
+	writer   Writer
+}
+
+// Messages are recorded before they are written, a response of the client to them must
+// never come first in the recording.
+func (w *recordingWriter) Write(msg []byte) error {
+	w.recorder.record(w.session, Outgoing, msg)
+	return w.writer.Write(msg)
+}
+
+// Reads a recording written by a Recorder.
+func ReadRecording(r io.Reader) ([]Entry, error) {
+	entries := []Entry{}
+	scanner := bufio.NewScanner(r)
+	// Messages carry whole documents.
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("replay: line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("replay: read recording: %w", err)
+	}
+	return entries, nil
+}
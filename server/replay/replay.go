@@ -0,0 +1,210 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"puter/engine"
+	"puter/interpreter"
+	"puter/logging"
+	"puter/unit"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait for the messages an incoming message made the engine send in the
+// recording. When they don't come, the replay moves on and the transcript shows it.
+const stepTimeout = 2 * time.Second
+
+// An incoming message of a replay and the messages the engine sent in response, before
+// the next incoming message.
+type Step struct {
+	Incoming json.RawMessage
+	Outgoing []json.RawMessage
+}
+
+// Plays the incoming messages of a recording of a single session to a new engine.
+//
+// Each message is only sent once the engine sent as many messages in response as it did
+// in the recording, so that a replay interleaves like the recorded session did, including
+// responses to the requests of the server. Timing is not replayed otherwise.
+func Replay(ctx context.Context, entries []Entry) ([]*Step, error) {
+	steps := []*Step{}
+	// How many messages the engine sent after each step in the recording.
+	expected := []int{}
+	for _, entry := range entries {
+		if entry.Session != entries[0].Session {
+			return nil, fmt.Errorf("replay: the recording has several sessions, %q and %q", entries[0].Session, entry.Session)
+		}
+		switch entry.Direction {
+		case Incoming:
+			if entry.Message == nil {
+				return nil, fmt.Errorf("replay: message that is not JSON: %q", entry.Invalid)
+			}
+			steps = append(steps, &Step{Incoming: entry.Message})
+			expected = append(expected, 0)
+		case Outgoing:
+			if len(expected) > 0 {
+				expected[len(expected)-1]++
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	reader := &memoryReader{messages: make(chan []byte)}
+	writer := newMemoryWriter()
+	exchangeRates := unit.NewExchangeRates()
+	converters := &unit.Converters{
+		ConvertCurrency:  exchangeRates.Converter(),
+		ConvertFixedUnit: unit.GetFixedUnitConverter(),
+	}
+	e := engine.NewEngine(
+		ctx,
+		reader,
+		writer,
+		logging.NewLogger(io.Discard),
+		interpreter.NewInterpreter(ctx, converters),
+		exchangeRates,
+	)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		e.Run(ctx)
+	}()
+
+	sent := 0
+	for i, step := range steps {
+		select {
+		case reader.messages <- step.Incoming:
+		case <-stopped:
+			// The engine exited, like it does after `exit`, the rest is never read.
+			steps = steps[:i]
+		}
+		if i == len(steps) {
+			break
+		}
+		step.Outgoing = writer.wait(sent+expected[i], stepTimeout)
+		sent += len(step.Outgoing)
+	}
+
+	close(reader.messages)
+	select {
+	case <-stopped:
+	case <-time.After(stepTimeout):
+		cancel()
+		<-stopped
+	}
+	if len(steps) > 0 {
+		last := steps[len(steps)-1]
+		last.Outgoing = append(last.Outgoing, writer.wait(0, 0)...)
+	}
+	return steps, nil
+}
+
+// Formats the steps of a replay for a golden file, every incoming message followed by
+// what was sent in response. Messages sent concurrently may be sent in any order, so the
+// messages of a step are sorted.
+func Transcript(steps []*Step) string {
+	var sb strings.Builder
+	for _, step := range steps {
+		fmt.Fprintf(&sb, "--> %s\n", canonical(step.Incoming))
+		outgoing := []string{}
+		for _, message := range step.Outgoing {
+			outgoing = append(outgoing, canonical(message))
+		}
+		slices.Sort(outgoing)
+		for _, message := range outgoing {
+			fmt.Fprintf(&sb, "<-- %s\n", message)
+		}
+	}
+	return sb.String()
+}
+
+// Compacts message with the keys of its objects sorted, the engine writes some params
+// from maps, in no particular order.
+func canonical(message json.RawMessage) string {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return string(message)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return string(message)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Hands the engine the messages of the recording, io.EOF once they are all read.
+type memoryReader struct {
+	messages chan []byte
+}
+
+func (r *memoryReader) Read() ([]byte, error) {
+	message, ok := <-r.messages
+	if !ok {
+		return nil, io.EOF
+	}
+	return message, nil
+}
+
+// Collects what the engine writes.
+type memoryWriter struct {
+	mu       sync.Mutex
+	messages []json.RawMessage
+	// Read by wait, written to whenever a message arrives.
+	written chan struct{}
+	// How many messages were taken by wait.
+	taken int
+}
+
+func newMemoryWriter() *memoryWriter {
+	return &memoryWriter{written: make(chan struct{}, 1)}
+}
+
+func (w *memoryWriter) Write(msg []byte) error {
+	w.mu.Lock()
+	w.messages = append(w.messages, slices.Clone(msg))
+	w.mu.Unlock()
+	select {
+	case w.written <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Waits up to timeout until count messages were written in total, then takes the
+// messages that were not taken yet.
+func (w *memoryWriter) wait(count int, timeout time.Duration) []json.RawMessage {
+	deadline := time.After(timeout)
+	for w.count() < count {
+		select {
+		case <-w.written:
+		case <-deadline:
+			return w.take()
+		}
+	}
+	return w.take()
+}
+
+func (w *memoryWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.messages)
+}
+
+func (w *memoryWriter) take() []json.RawMessage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	taken := w.messages[w.taken:]
+	w.taken = len(w.messages)
+	return taken
+}
@@ -0,0 +1,55 @@
+package replay
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the transcripts of the replays to the golden files")
+
+// Replays every recording in testdata and compares what the engine sent with the golden
+// file next to it. Run with -update to accept the current behavior.
+func TestReplay(t *testing.T) {
+	recordings, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, recording := range recordings {
+		name := strings.TrimSuffix(filepath.Base(recording), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			file, err := os.Open(recording)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			entries, err := ReadRecording(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			steps, err := Replay(context.Background(), entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := Transcript(steps)
+			golden := strings.TrimSuffix(recording, ".jsonl") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Expected a golden file, run with -update to write it: %v", err)
+			}
+			if got != string(expected) {
+				t.Fatalf("Expected the transcript of %s, got:\n%s", golden, got)
+			}
+		})
+	}
+}
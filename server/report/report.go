@@ -0,0 +1,120 @@
+// Package report turns interpretations into the versioned JSON schema documented in
+// protocol.md, shared by the puter/evaluate request and `puter eval --json`.
+package report
+
+import (
+	"math"
+	"puter/evaluation/evaluator/box"
+	"puter/interpreter"
+	lsproto "puter/lsp"
+	"puter/unit"
+	"puter/utils"
+)
+
+// Version of the schema. Raised whenever a field changes its meaning or goes away,
+// fields that are added don't raise it.
+const SchemaVersion = 1
+
+// The result of a pipe line.
+type Line struct {
+	Line int `json:"line"`
+	// The text after the pipe.
+	Text string `json:"text"`
+	// The result as shown in the editor, empty when the line could not be evaluated.
+	Result      string                `json:"result"`
+	Value       *Value                `json:"value"`
+	Diagnostics []*lsproto.Diagnostic `json:"diagnostics"`
+	Bindings    []*Binding            `json:"bindings"`
+	// Left out when the line is not an assertion, or one that could not be evaluated.
+	Assertion *Assertion `json:"assertion,omitzero"`
+}
+
+type Value struct {
+	// One of number, percentage, currency, unit or boolean.
+	Kind string `json:"kind"`
+	// Left out when the number is not finite, the result still shows it.
+	Number *float64 `json:"number,omitzero"`
+	// How the number is written: decimal, hex, binary or NaN.
+	NumberFormat string `json:"numberFormat,omitzero"`
+	// The unit abbreviation like km, or the ISO 4217 code of a currency.
+	Unit string `json:"unit,omitzero"`
+	// What the unit measures, like length or mass, or currency.
+	UnitFamily string `json:"unitFamily,omitzero"`
+	Boolean    *bool  `json:"boolean,omitzero"`
+}
+
+type Assertion struct {
+	Passed bool `json:"passed"`
+	// The comparison that failed, or the last one when the assertion passed. Left out
+	// for an assertion without a comparison.
+	Operator string `json:"operator,omitzero"`
+	Actual   *Value `json:"actual,omitzero"`
+	Expected *Value `json:"expected,omitzero"`
+}
+
+// An identifier read or assigned on a line.
+type Binding struct {
+	Name     string        `json:"name"`
+	Range    lsproto.Range `json:"range"`
+	Assigned bool          `json:"assigned"`
+	// Null when the identifier has no value.
+	Value *Value `json:"value"`
+}
+
+func NewLine(interpretation *interpreter.Interpretation) *Line {
+	line := &Line{
+		Line:        interpretation.LineIndex,
+		Text:        interpretation.Text,
+		Result:      interpretation.EvalResult,
+		Value:       NewValue(interpretation.Box),
+		Diagnostics: interpretation.Diagnostics,
+		Bindings:    []*Binding{},
+	}
+	if assertion := interpretation.Assertion; assertion != nil {
+		line.Assertion = &Assertion{Passed: assertion.Passed}
+		if comparison := assertion.Comparison; comparison != nil {
+			line.Assertion.Operator = comparison.Operator
+			line.Assertion.Actual = NewValue(comparison.Left)
+			line.Assertion.Expected = NewValue(comparison.Right)
+		}
+	}
+	for _, binding := range interpretation.Bindings {
+		line.Bindings = append(line.Bindings, &Binding{
+			Name:     binding.Name,
+			Range:    interpretation.BindingRange(binding),
+			Assigned: binding.Assigned,
+			Value:    NewValue(binding.Value),
+		})
+	}
+	return line
+}
+
+// Returns nil for a value that is not one of the kinds of the schema, or no value at all.
+func NewValue(value box.Box) *Value {
+	switch v := value.(type) {
+	case *box.NumberBox:
+		return &Value{Kind: "number", Number: finite(v.Value), NumberFormat: string(v.NumberType)}
+	case *box.PercentBox:
+		return &Value{Kind: "percentage", Number: finite(v.Value)}
+	case *box.CurrencyBox:
+		return &Value{Kind: "currency", Number: finite(v.Number.Value), NumberFormat: string(v.Number.NumberType), Unit: v.Unit, UnitFamily: "currency"}
+	case *box.FixedUnitBox:
+		family := "unknown"
+		if detail, ok := unit.FixedUnitTypes[v.FixedUnitType]; ok {
+			family = detail.UnitFor
+		}
+		return &Value{Kind: "unit", Number: finite(v.Number.Value), NumberFormat: string(v.Number.NumberType), Unit: string(v.FixedUnitType), UnitFamily: family}
+	case *box.BooleanBox:
+		return &Value{Kind: "boolean", Boolean: utils.PointerTo(v.Value)}
+	default:
+		return nil
+	}
+}
+
+// JSON has no NaN or infinity.
+func finite(number float64) *float64 {
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil
+	}
+	return &number
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"puter/engine"
+	"puter/interpreter"
+	"puter/logging"
+	lsproto "puter/lsp"
+	"puter/replay"
+	"puter/transport"
+	"puter/unit"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// What the engines of every client have in common. Each client gets an engine and an
+// interpreter of its own, since they hold its documents and settings, but the exchange
+// rates fetched for one are used by all.
+type server struct {
+	logger             logging.Logger
+	exchangeRates      *unit.ExchangeRates
+	fixedUnitConverter unit.ValueConverter
+	// The most detailed level of the log sent to clients, see --log-level.
+	clientLogLevel logging.Level
+	// Records the messages of every client when set, see --record.
+	recorder *replay.Recorder
+	// Origins of web pages allowed to connect over WebSocket, see --websocket-origins.
+	allowedOrigins []string
+	// Clients connected over TCP or WebSocket.
+	connections sync.WaitGroup
+}
+
+// Runs an engine for a single client until it exits. Returns the exit code it asked for.
+func (s *server) serve(ctx context.Context, session string, reader engine.Reader, writer engine.Writer) int {
+	if s.recorder != nil {
+		reader = s.recorder.Reader(session, reader)
+		writer = s.recorder.Writer(session, writer)
+	}
+	exchangeRates := s.exchangeRates.Share()
+	converters := &unit.Converters{
+		ConvertCurrency:  exchangeRates.Converter(),
+		ConvertFixedUnit: s.fixedUnitConverter,
+	}
+
+	interpreter := interpreter.NewInterpreter(ctx, converters)
+
+	engine := engine.NewEngine(
+		ctx,
+		reader,
+		writer,
+		s.logger,
+		interpreter,
+		exchangeRates,
+	)
+	engine.SetClientLogLevel(s.clientLogLevel)
+
+	if err := engine.Run(ctx); err != nil {
+		s.logger.Error("engine stopped: ", err)
+	}
+	if s.recorder != nil && s.recorder.Err() != nil {
+		s.logger.Warn("the session was not fully recorded: ", s.recorder.Err())
+	}
+	return engine.ExitCode()
+}
+
+// Accepts clients over TCP on tcpAddress and over WebSocket on webSocketAddress, either
+// can be empty, until ctx is done. Returns once every client disconnected.
+func (s *server) listen(ctx context.Context, tcpAddress string, webSocketAddress string) error {
+	g, ctx := errgroup.WithContext(ctx)
+	if tcpAddress != "" {
+		listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", tcpAddress)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("listening for TCP clients on ", listener.Addr())
+		g.Go(func() error { return s.serveTCP(ctx, listener) })
+	}
+	if webSocketAddress != "" {
+		listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", webSocketAddress)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("listening for WebSocket clients on ", listener.Addr())
+		g.Go(func() error { return s.serveWebSocket(ctx, listener) })
+	}
+	err := g.Wait()
+	s.connections.Wait()
+	return err
+}
+
+// Clients speak the base protocol over the connection, like they would over stdio.
+func (s *server) serveTCP(ctx context.Context, listener net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.connections.Go(func() {
+			s.serveConnection(ctx, conn, conn.RemoteAddr().String(), lsproto.NewBaseReader(conn), lsproto.NewBaseWriter(conn))
+		})
+	}
+}
+
+// Every request on any path is upgraded, each WebSocket message is a JSON-RPC message.
+func (s *server) serveWebSocket(ctx context.Context, listener net.Listener) error {
+	httpServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			conn, err := transport.Upgrade(w, req, s.allowedOrigins)
+			if err != nil {
+				s.logger.Warn("could not accept WebSocket client ", req.RemoteAddr, ": ", err)
+				return
+			}
+			s.serveConnection(ctx, conn, req.RemoteAddr, conn, conn)
+		}),
+	}
+	stop := context.AfterFunc(ctx, func() { httpServer.Close() })
+	defer stop()
+	// The handlers run on goroutines of httpServer, which forgets connections once they
+	// are upgraded. Connections are counted when accepted instead, before Serve returns.
+	if err := httpServer.Serve(countingListener{listener, &s.connections}); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Serves a connected client, the connection is closed once its engine stops or ctx is done.
+func (s *server) serveConnection(ctx context.Context, conn io.Closer, remote string, reader engine.Reader, writer engine.Writer) {
+	s.logger.Info("client ", remote, " connected")
+	// Closing the connection is the only way to interrupt a read.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+	exitCode := s.serve(ctx, remote, reader, writer)
+	s.logger.Info("client ", remote, " disconnected with exit code ", exitCode)
+}
+
+// Adds every connection it accepts to connections, until the connection is closed.
+type countingListener struct {
+	net.Listener
+	connections *sync.WaitGroup
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.connections.Add(1)
+	return &countedConn{Conn: conn, done: sync.OnceFunc(l.connections.Done)}, nil
+}
+
+type countedConn struct {
+	net.Conn
+	done func()
+}
+
+func (c *countedConn) Close() error {
+	defer c.done()
+	return c.Conn.Close()
+}
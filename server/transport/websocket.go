@@ -0,0 +1,259 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6455
+
+var (
+	ErrNotWebSocket    = errors.New("websocket: not a websocket handshake")
+	ErrForbiddenOrigin = errors.New("websocket: origin not allowed")
+	ErrMessageTooLarge = errors.New("websocket: message too large")
+	ErrInvalidFrame    = errors.New("websocket: invalid frame")
+)
+
+// Appended to the key of the client to prove that the handshake was understood.
+const handshakeGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Messages are whole documents at most, anything larger is not from an editor.
+const maxMessageSize = 64 << 20
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Server side of a WebSocket connection, carrying one JSON-RPC message per WebSocket
+// message, without the headers of the base protocol. This is what browser based clients
+// like monaco-languageclient send.
+type WebSocketConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// Held while writing a frame, pings are answered while messages are being written.
+	mu sync.Mutex
+}
+
+// Completes the opening handshake of a WebSocket request and takes over its connection.
+//
+// Browsers let any web page open a WebSocket to localhost, so a handshake from a page of
+// another origin is refused unless its origin is one of allowedOrigins, or that has "*".
+func Upgrade(w http.ResponseWriter, req *http.Request, allowedOrigins []string) (*WebSocketConn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != http.MethodGet ||
+		!headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") ||
+		key == "" {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, ErrNotWebSocket
+	}
+	if origin := req.Header.Get("Origin"); !originAllowed(origin, req.Host, allowedOrigins) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("%w: %s", ErrForbiddenOrigin, origin)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, ErrNotWebSocket
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: handshake: %w", err)
+	}
+	return &WebSocketConn{conn: conn, r: rw.Reader}, nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + handshakeGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Clients that aren't browsers send no origin, pages served by the host itself are of
+// the same origin.
+func originAllowed(origin string, host string, allowedOrigins []string) bool {
+	if origin == "" || slices.Contains(allowedOrigins, "*") || slices.Contains(allowedOrigins, origin) {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, host)
+}
+
+// Reports whether one of the comma separated values of the header is token, ignoring case.
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for part := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reads the next text or binary message. Pings are answered on the way, and a close
+// frame is answered and reported as io.EOF.
+func (c *WebSocketConn) Read() ([]byte, error) {
+	message := []byte{}
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			// Echoes the status code, if there is one, as the spec asks.
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, fmt.Errorf("%w: new message inside a fragmented one", ErrInvalidFrame)
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, fmt.Errorf("%w: continuation without a message", ErrInvalidFrame)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %#x", ErrInvalidFrame, opcode)
+		}
+
+		if len(message)+len(payload) > maxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *WebSocketConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return false, 0, nil, eofOrError(err)
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", ErrInvalidFrame)
+	}
+	masked := header[1]&0x80 != 0
+	if !masked {
+		// Clients always mask what they send.
+		return false, 0, nil, fmt.Errorf("%w: unmasked frame from the client", ErrInvalidFrame)
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, extended); err != nil {
+			return false, 0, nil, eofOrError(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, extended); err != nil {
+			return false, 0, nil, eofOrError(err)
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+	if opcode >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, fmt.Errorf("%w: control frames are short and never fragmented", ErrInvalidFrame)
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.r, mask); err != nil {
+		return false, 0, nil, eofOrError(err)
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, eofOrError(err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// A connection that ends between frames is closed, one that ends inside of a frame is not.
+func eofOrError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	return fmt.Errorf("websocket: read frame: %w", err)
+}
+
+// Sends data as a single text message.
+func (c *WebSocketConn) Write(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("websocket: write frame: %w", err)
+	}
+	return nil
+}
+
+func (c *WebSocketConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// The example of the RFC.
+	accept := acceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the accept key of the RFC, got %s", accept)
+	}
+}
+
+// A frame as a client sends it, masked.
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func newPipe(t *testing.T) (*WebSocketConn, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &WebSocketConn{conn: server, r: bufio.NewReader(server)}, client
+}
+
+func TestReadFragmentedMessage(t *testing.T) {
+	conn, client := newPipe(t)
+	go func() {
+		client.Write(clientFrame(false, opText, []byte(`{"id":`)))
+		client.Write(clientFrame(true, opPing, []byte("ping")))
+		client.Write(clientFrame(true, opContinuation, []byte(`1}`)))
+	}()
+
+	pong := make(chan []byte, 1)
+	go func() {
+		frame := make([]byte, 6)
+		io.ReadFull(client, frame)
+		pong <- frame
+	}()
+
+	message, err := conn.Read()
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %+v", err)
+	}
+	if string(message) != `{"id":1}` {
+		t.Fatalf("Expected the fragments to be joined, got %s", message)
+	}
+	if frame := <-pong; !bytes.Equal(frame, []byte{0x80 | opPong, 4, 'p', 'i', 'n', 'g'}) {
+		t.Fatalf("Expected the ping to be answered, got %v", frame)
+	}
+}
+
+func TestReadClose(t *testing.T) {
+	conn, client := newPipe(t)
+	go func() {
+		client.Write(clientFrame(true, opClose, []byte{0x03, 0xe8}))
+		io.ReadAll(client)
+	}()
+
+	if _, err := conn.Read(); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %+v", err)
+	}
+}
+
+func TestReadUnmaskedFrame(t *testing.T) {
+	conn, client := newPipe(t)
+	go client.Write([]byte{0x80 | opText, 2, '{', '}'})
+
+	if _, err := conn.Read(); err == nil {
+		t.Fatalf("Expected unmasked frames to be rejected")
+	}
+}
+
+func TestWriteLengths(t *testing.T) {
+	for _, tc := range []struct {
+		length int
+		header []byte
+	}{
+		{125, []byte{0x80 | opText, 125}},
+		{126, []byte{0x80 | opText, 126, 0, 126}},
+		{70000, []byte{0x80 | opText, 127, 0, 0, 0, 0, 0, 1, 0x11, 0x70}},
+	} {
+		conn, client := newPipe(t)
+		go conn.Write(bytes.Repeat([]byte("x"), tc.length))
+
+		frame := make([]byte, len(tc.header)+tc.length)
+		if _, err := io.ReadFull(client, frame); err != nil {
+			t.Fatalf("Expected err to be nil, got %+v", err)
+		}
+		if !bytes.Equal(frame[:len(tc.header)], tc.header) {
+			t.Fatalf("Expected header %v for %d bytes, got %v", tc.header, tc.length, frame[:len(tc.header)])
+		}
+	}
+}
+
+func TestUpgradeOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		origin         string
+		allowedOrigins []string
+		allowed        bool
+	}{
+		{"", nil, true},
+		{"http://localhost:7778", nil, true},
+		{"https://example.com", nil, false},
+		{"http://localhost:3000", nil, false},
+		{"http://localhost:3000", []string{"http://localhost:3000"}, true},
+		{"https://example.com", []string{"http://localhost:3000"}, false},
+		{"https://example.com", []string{"*"}, true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:7778/", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		w := httptest.NewRecorder()
+
+		// The recorder can't be hijacked, an allowed handshake fails after the origin is checked.
+		_, err := Upgrade(w, req, tc.allowedOrigins)
+		if forbidden := errors.Is(err, ErrForbiddenOrigin); forbidden == tc.allowed {
+			t.Fatalf("Expected %q allowed by %v to be %t, got %+v", tc.origin, tc.allowedOrigins, tc.allowed, err)
+		}
+		if !tc.allowed && w.Code != http.StatusForbidden {
+			t.Fatalf("Expected status %d for %q, got %d", http.StatusForbidden, tc.origin, w.Code)
+		}
+	}
+}
@@ -1,15 +1,133 @@
 package unit
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
+// The exchange-rate API used when no other endpoint is configured.
+const DefaultExchangeRateEndpoint = "https://api.frankfurter.dev/v1/latest"
+
+// How long fetched rates are used before they are fetched again. The reference rates
+// behind the default endpoint are only updated once per working day.
+const maxRateAge = 12 * time.Hour
+
+// Returns a currency converter that fetches rates from the default endpoint.
 func GetCurrencyConverter() ValueConverter {
+	return NewExchangeRates().Converter()
+}
+
+// Called when rates for base start being fetched. The function it returns is called
+// once the fetch is done, with the error if it failed and the outdated rates that are
+// used instead, if there are any.
+type FetchObserver func(base string) func(err error, fallback *FrankfurterResponse)
+
+type cachedRates struct {
+	*FrankfurterResponse
+	fetchedAt time.Time
+}
+
+type rateKey struct {
+	endpoint string
+	base     string
+}
+
+// Rates fetched so far, by the endpoint they came from and their base currency.
+type rateCache struct {
+	mu    sync.Mutex
+	rates map[rateKey]cachedRates
+}
+
+func (c *rateCache) get(key rateKey) (cachedRates, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rates, ok := c.rates[key]
+	return rates, ok
+}
+
+func (c *rateCache) set(key rateKey, rates cachedRates) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rates[key] = rates
+}
+
+// Source of exchange rates. Rates are fetched per base currency and cached for maxRateAge.
+// When fetching them again fails, the outdated rates keep being used.
+//
+// Where rates come from can be changed while conversions are running, see Configure.
+// Exchange rates made with Share have a configuration of their own but use the same
+// cached rates.
+type ExchangeRates struct {
+	mu       sync.Mutex
+	endpoint string
+	offline  bool
+	cache    *rateCache
+	observer FetchObserver
+	now      func() time.Time
+	// Done once Close is called, aborts the requests in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewExchangeRates() *ExchangeRates {
+	return newExchangeRates(&rateCache{rates: map[rateKey]cachedRates{}})
+}
+
+func newExchangeRates(cache *rateCache) *ExchangeRates {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExchangeRates{
+		endpoint: DefaultExchangeRateEndpoint,
+		cache:    cache,
+		now:      time.Now,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Returns exchange rates with the default configuration that use the rates r cached,
+// and the other way around. Closing either of them does not affect the other.
+func (r *ExchangeRates) Share() *ExchangeRates {
+	shared := newExchangeRates(r.cache)
+	shared.now = r.now
+	return shared
+}
+
+// Aborts the requests in flight and stops fetching rates for good. Rates that are
+// already cached can still be used.
+func (r *ExchangeRates) Close() {
+	r.cancel()
+}
+
+// Sets the endpoint rates are fetched from, a frankfurter compatible `latest` URL, and whether
+// fetching is allowed at all. In offline mode only rates that are already cached are used.
+//
+// Rates are only ever used with the endpoint they were fetched from.
+func (r *ExchangeRates) Configure(endpoint string, offline bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if endpoint == "" {
+		endpoint = DefaultExchangeRateEndpoint
+	}
+	r.endpoint = endpoint
+	r.offline = offline
+}
+
+// Sets who is told about the rates being fetched, replacing the previous observer.
+func (r *ExchangeRates) Observe(observer FetchObserver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observer = observer
+}
+
+func (r *ExchangeRates) Converter() ValueConverter {
 	return func(fromValue float64, fromUnit string, toUnit string) (float64, error) {
 		if fromUnit == toUnit {
 			return fromValue, nil
@@ -28,7 +146,7 @@ func GetCurrencyConverter() ValueConverter {
 			return -1, fmt.Errorf("Conversion between %s and %s not supported", fromUnit, toUnit)
 		}
 
-		conversionRate, err := fetchCurrencyConversionRate(fromUnit, toUnit)
+		conversionRate, err := r.rate(fromUnit, toUnit)
 		if err != nil {
 			return 0.0, err
 		}
@@ -59,33 +177,44 @@ type FrankfurterResponse struct {
 	Rates  map[string]float64 `json:"rates"`
 }
 
-var responseCache = map[string]*FrankfurterResponse{}
-
-func fetchCurrencyConversionRate(fromUnit string, toUnit string) (float64, error) {
+func (r *ExchangeRates) rate(fromUnit string, toUnit string) (float64, error) {
 	data, err := func() (*FrankfurterResponse, error) {
-		if result, ok := responseCache[fromUnit]; ok {
-			return result, nil
+		r.mu.Lock()
+		endpoint, offline, observer := r.endpoint, r.offline, r.observer
+		r.mu.Unlock()
+		key := rateKey{endpoint: endpoint, base: fromUnit}
+		cached, ok := r.cache.get(key)
+		if ok && (offline || r.now().Sub(cached.fetchedAt) < maxRateAge) {
+			return cached.FrankfurterResponse, nil
 		}
-
-		resp, err := http.Get(fmt.Sprintf("https://api.frankfurter.dev/v1/latest?base=%s", fromUnit))
-		if err != nil {
-			return nil, errors.New("Request to frankfruter api failed")
+		if offline {
+			return nil, fmt.Errorf("No exchange rates for %s are available offline", fromUnit)
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, errors.New("Could not read response body")
+		if r.ctx.Err() != nil {
+			return nil, fmt.Errorf("No exchange rates for %s are available, fetching was stopped", fromUnit)
 		}
-
-		var data FrankfurterResponse
-		if err := json.Unmarshal(body, &data); err != nil {
-			return nil, errors.New("Could not read response body")
+		done := func(error, *FrankfurterResponse) {}
+		if observer != nil {
+			done = observer(fromUnit)
 		}
+		data, err := r.fetch(endpoint, fromUnit)
+		if err != nil {
+			if r.ctx.Err() != nil {
+				done(r.ctx.Err(), nil)
+				return nil, err
+			}
+			if ok {
+				done(err, cached.FrankfurterResponse)
+				return cached.FrankfurterResponse, nil
+			}
+			done(err, nil)
+			return nil, err
+		}
+		done(nil, nil)
 
-		responseCache[fromUnit] = &data
-
-		return &data, nil
+		r.cache.set(key, cachedRates{FrankfurterResponse: data, fetchedAt: r.now()})
+		return data, nil
 	}()
 
 	if err != nil {
@@ -99,3 +228,37 @@ func fetchCurrencyConversionRate(fromUnit string, toUnit string) (float64, error
 
 	return rate, nil
 }
+
+func (r *ExchangeRates) fetch(endpoint string, base string) (*FrankfurterResponse, error) {
+	// The endpoint may have a query of its own, like an access key.
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid exchange rate endpoint: %w", err)
+	}
+	query := endpointUrl.Query()
+	query.Set("base", base)
+	endpointUrl.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, endpointUrl.String(), nil)
+	if err != nil {
+		return nil, errors.New("Request to frankfruter api failed")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.New("Request to frankfruter api failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Request to frankfruter api failed with status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("Could not read response body")
+	}
+
+	var data FrankfurterResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, errors.New("Could not read response body")
+	}
+	return &data, nil
+}
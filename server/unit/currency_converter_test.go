@@ -0,0 +1,212 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newRatesServer(t *testing.T, rate float64, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		base := r.URL.Query().Get("base")
+		fmt.Fprintf(w, `{"amount":1,"base":%q,"date":"2025-01-01","rates":{"THB":%g}}`, base, rate)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestExchangeRatesFromConfiguredEndpoint(t *testing.T) {
+	requests := 0
+	server := newRatesServer(t, 30, &requests)
+	rates := NewExchangeRates()
+	rates.Configure(server.URL, false)
+	convert := rates.Converter()
+
+	for range 2 {
+		converted, err := convert(2, "usd", "thb")
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %+v", err)
+		}
+		if converted != 60 {
+			t.Fatalf("Expected 60, got %g", converted)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Expected rates to be fetched once, got %d requests", requests)
+	}
+}
+
+func TestExchangeRatesFromEndpointWithQuery(t *testing.T) {
+	query := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"amount":1,"base":"USD","date":"2025-01-01","rates":{"THB":30}}`)
+	}))
+	t.Cleanup(server.Close)
+	rates := NewExchangeRates()
+	rates.Configure(server.URL+"/latest?access_key=a%26b", false)
+
+	if _, err := rates.Converter()(2, "usd", "thb"); err != nil {
+		t.Fatalf("Expected err to be nil, got %+v", err)
+	}
+	if query != "access_key=a%26b&base=USD" {
+		t.Fatalf("Expected the base next to the query of the endpoint, got %s", query)
+	}
+}
+
+func TestExchangeRatesOffline(t *testing.T) {
+	requests := 0
+	server := newRatesServer(t, 30, &requests)
+	rates := NewExchangeRates()
+	rates.Configure(server.URL, true)
+	convert := rates.Converter()
+
+	if _, err := convert(2, "usd", "thb"); err == nil {
+		t.Fatalf("Expected an error without cached rates")
+	}
+	if requests != 0 {
+		t.Fatalf("Expected no request in offline mode, got %d", requests)
+	}
+
+	rates.Configure(server.URL, false)
+	if _, err := convert(2, "usd", "thb"); err != nil {
+		t.Fatalf("Expected err to be nil, got %+v", err)
+	}
+	rates.Configure(server.URL, true)
+	if _, err := convert(2, "usd", "thb"); err != nil {
+		t.Fatalf("Expected cached rates to be used offline, got %+v", err)
+	}
+}
+
+func TestExchangeRatesCachedPerEndpoint(t *testing.T) {
+	firstRequests, secondRequests := 0, 0
+	first := newRatesServer(t, 30, &firstRequests)
+	second := newRatesServer(t, 40, &secondRequests)
+	rates := NewExchangeRates()
+	convert := rates.Converter()
+
+	rates.Configure(first.URL, false)
+	convert(1, "usd", "thb")
+	rates.Configure(second.URL, false)
+	converted, err := convert(1, "usd", "thb")
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %+v", err)
+	}
+	if converted != 40 || secondRequests != 1 {
+		t.Fatalf("Expected the rate of the new endpoint, got %g", converted)
+	}
+}
+
+func TestExchangeRatesCloseAbortsRequests(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	rates := NewExchangeRates()
+	rates.Configure(server.URL, false)
+	convert := rates.Converter()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := convert(1, "usd", "thb")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	rates.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("Expected the aborted request to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Close to abort the request in flight")
+	}
+	if _, err := convert(1, "usd", "thb"); err == nil {
+		t.Fatalf("Expected no more rates to be fetched after Close")
+	}
+}
+
+func TestExchangeRatesFallBackToOutdatedRates(t *testing.T) {
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"amount":1,"base":"USD","date":"2025-01-01","rates":{"THB":30}}`)
+	}))
+	t.Cleanup(server.Close)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	rates := NewExchangeRates()
+	rates.now = func() time.Time { return now }
+	rates.Configure(server.URL, false)
+
+	type fetch struct {
+		base     string
+		err      error
+		fallback *FrankfurterResponse
+	}
+	fetches := []fetch{}
+	rates.Observe(func(base string) func(error, *FrankfurterResponse) {
+		return func(err error, fallback *FrankfurterResponse) {
+			fetches = append(fetches, fetch{base, err, fallback})
+		}
+	})
+	convert := rates.Converter()
+
+	if _, err := convert(1, "usd", "thb"); err != nil {
+		t.Fatalf("Expected err to be nil, got %+v", err)
+	}
+	failing = true
+	now = now.Add(maxRateAge)
+	converted, err := convert(2, "usd", "thb")
+	if err != nil {
+		t.Fatalf("Expected the outdated rates to be used, got %+v", err)
+	}
+	if converted != 60 {
+		t.Fatalf("Expected 60, got %g", converted)
+	}
+
+	if len(fetches) != 2 {
+		t.Fatalf("Expected 2 fetches, got %d", len(fetches))
+	}
+	if fetches[0].base != "USD" || fetches[0].err != nil {
+		t.Fatalf("Expected the first fetch to succeed, got %+v", fetches[0])
+	}
+	if fetches[1].err == nil || fetches[1].fallback == nil || fetches[1].fallback.Date != "2025-01-01" {
+		t.Fatalf("Expected the second fetch to fall back to the rates of 2025-01-01, got %+v", fetches[1])
+	}
+}
+
+func TestSharedExchangeRates(t *testing.T) {
+	requests := 0
+	server := newRatesServer(t, 30, &requests)
+	rates := NewExchangeRates()
+	rates.Configure(server.URL, false)
+	shared := rates.Share()
+	shared.Configure(server.URL, true)
+
+	if _, err := shared.Converter()(1, "usd", "thb"); err == nil {
+		t.Fatalf("Expected an error without cached rates")
+	}
+	if _, err := rates.Converter()(1, "usd", "thb"); err != nil {
+		t.Fatalf("Expected err to be nil, got %+v", err)
+	}
+	rates.Close()
+	converted, err := shared.Converter()(2, "usd", "thb")
+	if err != nil {
+		t.Fatalf("Expected the rates fetched by the other to be used, got %+v", err)
+	}
+	if converted != 60 || requests != 1 {
+		t.Fatalf("Expected 60 from a single request, got %g from %d requests", converted, requests)
+	}
+}